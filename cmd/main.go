@@ -1,13 +1,19 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"order-service/internal/api"
+	"order-service/internal/client"
 	"order-service/internal/config"
+	"order-service/internal/idempotency"
+	"order-service/internal/idgen"
+	"order-service/internal/promotion"
+	"order-service/internal/quote"
 	"order-service/internal/repository"
 	"order-service/internal/service"
 	"order-service/internal/sharding"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -26,13 +32,17 @@ import (
 // 	return db, nil
 // }
 
-func connectDBEnv(host, port, user, pass, dbname string) (*sql.DB, error) {
-	dsn := user + ":" + pass + "@tcp(" + host + ":" + port + ")/" + dbname
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
+// newIDGenerator uses the node number from NODE_ID when it is set, and
+// otherwise leases a free one in Redis.
+func newIDGenerator(rdb *redis.Client) (*idgen.Generator, error) {
+	if node := os.Getenv("NODE_ID"); node != "" {
+		nodeInt, err := strconv.Atoi(node)
+		if err != nil {
+			return nil, err
+		}
+		return idgen.NewGenerator(nodeInt)
 	}
-	return db, nil
+	return idgen.ClaimNode(context.Background(), rdb, 30*time.Second)
 }
 
 func main() {
@@ -54,15 +64,15 @@ func main() {
 	// 	panic(err)
 	// }
 
-	db1, err := connectDBEnv(os.Getenv("DB1_HOST"), os.Getenv("DB1_PORT"), os.Getenv("DB1_USER"), os.Getenv("DB1_PASS"), os.Getenv("DB1_DBNAME"))
+	shardCount, err := config.ShardCount()
 	if err != nil {
 		panic(err)
 	}
-	db2, err := connectDBEnv(os.Getenv("DB2_HOST"), os.Getenv("DB2_PORT"), os.Getenv("DB2_USER"), os.Getenv("DB2_PASS"), os.Getenv("DB2_DBNAME"))
+	dbCount, err := config.ShardDBCount()
 	if err != nil {
 		panic(err)
 	}
-	db3, err := connectDBEnv(os.Getenv("DB3_HOST"), os.Getenv("DB3_PORT"), os.Getenv("DB3_USER"), os.Getenv("DB3_PASS"), os.Getenv("DB3_DBNAME"))
+	dbShards, err := config.NewMySQLShards(max(shardCount, dbCount))
 	if err != nil {
 		panic(err)
 	}
@@ -78,12 +88,85 @@ func main() {
 
 		kafkaWriter = config.NewKafkaWrite("order-topic")
 	}
-	router := sharding.NewShardRouter(3)
+	strategy, err := config.NewShardStrategy(shardCount)
+	if err != nil {
+		panic(err)
+	}
+	router := sharding.NewShardRouter(strategy)
+	topology, err := sharding.LoadTopology(context.Background(), rdb)
+	if err != nil {
+		panic(err)
+	}
+	router.SetTopology(topology)
+	go router.WatchTopology(context.Background(), rdb, 5*time.Second)
+
+	idGen, err := newIDGenerator(rdb)
+	if err != nil {
+		panic(err)
+	}
 
-	orderRepo := repository.NewOrderRepository([]*sql.DB{db1, db2, db3}, router)
-	orderService := service.NewOrderService(*orderRepo, "http://localhost:8081", "http://localhost:8083", kafkaWriter, rdb)
+	orderRepo := repository.NewOrderRepository(dbShards, router)
+	reservationTTL, err := config.Duration("RESERVATION_TTL", 15*time.Minute)
+	if err != nil {
+		panic(err)
+	}
+	productClient := client.NewProductClient(config.Env("PRODUCT_SERVICE_URL", "http://localhost:8081"), client.DefaultOptions())
+	pricingCacheTTL, err := config.Duration("PRICING_CACHE_TTL", 5*time.Second)
+	if err != nil {
+		panic(err)
+	}
+	pricingClient := client.NewCachedPricingClient(
+		client.NewPricingClient(config.Env("PRICING_SERVICE_URL", "http://localhost:8083"), client.DefaultOptions()),
+		rdb, pricingCacheTTL)
+	quoteTTL, err := config.Duration("QUOTE_TTL", 10*time.Minute)
+	if err != nil {
+		panic(err)
+	}
+	quoteStore := quote.NewStore(rdb, []byte(config.Env("QUOTE_SECRET", "secret")), quoteTTL)
+	fxProvider, err := config.NewFXProvider()
+	if err != nil {
+		panic(err)
+	}
+	taxCalculator, err := config.NewTaxCalculator()
+	if err != nil {
+		panic(err)
+	}
+	var paymentRequester service.PaymentRequester = service.NoopPaymentRequester{}
+	if kafkaWriter != nil {
+		paymentRequester = service.NewKafkaPaymentRequester(config.NewKafkaWrite(config.Env("PAYMENT_REQUEST_TOPIC", "payment-requests")))
+	}
+	orderService := service.NewOrderService(*orderRepo, productClient, pricingClient, kafkaWriter, rdb, idGen, reservationTTL, quoteStore, fxProvider, promotion.NewStore(rdb), taxCalculator, paymentRequester)
 	orderHandler := api.NewOrderHandler(*orderService)
 
+	go orderService.RunReservationSweeper(context.Background(), 10*time.Second)
+
+	paymentDeadline, err := config.Duration("ORDER_PAYMENT_DEADLINE", 15*time.Minute)
+	if err != nil {
+		panic(err)
+	}
+	expiryScheduler := service.NewExpiryScheduler(orderService, rdb, paymentDeadline, 30*time.Second)
+	go expiryScheduler.Run(context.Background())
+
+	checkoutStaleAfter, err := config.Duration("CHECKOUT_STALE_AFTER", time.Minute)
+	if err != nil {
+		panic(err)
+	}
+	go service.NewCheckoutRecovery(orderService, rdb, checkoutStaleAfter, 30*time.Second).Run(context.Background())
+
+	if kafkaWriter != nil {
+		outboxRelay := service.NewOutboxRelay(*orderRepo, kafkaWriter, rdb, time.Second)
+		go outboxRelay.Run(context.Background())
+
+		priceChanges := config.NewKafkaReader(config.Env("PRICE_CHANGE_TOPIC", "price-changed"), "order-service-pricing-cache")
+		go service.NewPriceChangeConsumer(priceChanges, pricingClient).Run(context.Background())
+
+		// every instance is in the same group, so each payment event is
+		// applied by one of them
+		payments := config.NewKafkaReader(config.Env("PAYMENT_TOPIC", "payment-events"), "order-service-payments")
+		paymentDeadLetter := config.NewKafkaWrite(config.Env("PAYMENT_DEAD_LETTER_TOPIC", "payment-events-dlq"))
+		go service.NewPaymentConsumer(payments, paymentDeadLetter, orderService).Run(context.Background())
+	}
+
 	e := echo.New()
 	config := middleware.RateLimiterConfig{
 		Skipper: middleware.DefaultSkipper,
@@ -113,9 +196,37 @@ func main() {
 	e.Use(echojwt.JWT([]byte("secret")))
 	e.Use(middleware.RateLimiterWithConfig(config))
 
-	e.POST("/orders", orderHandler.CreateOrder)
-	e.PUT("/orders", orderHandler.UpdateOrder)
-	e.DELETE("/orders/:id", orderHandler.CancelOrder)
+	e.GET("/orders", orderHandler.ListOrders)
+	// customers only get at their own orders
+	ownerOnly := orderHandler.RequireOwner
+	e.GET("/orders/:id", orderHandler.GetOrder, ownerOnly)
+	e.GET("/orders/:id/transitions", orderHandler.ListStatusTransitions, ownerOnly)
+	e.GET("/orders/:id/history", orderHandler.OrderHistory, ownerOnly)
+	e.GET("/orders/:id/line-changes", orderHandler.ListLineChanges, ownerOnly)
+	e.GET("/orders/:id/checkout", orderHandler.GetCheckout, ownerOnly)
+	e.GET("/orders/:id/returns", orderHandler.ListReturns, ownerOnly)
+	idempotencyStore := idempotency.NewStore(rdb, time.Minute, 24*time.Hour)
+	e.POST("/orders", orderHandler.CreateOrder, api.Idempotency(idempotencyStore, api.OrderIdempotencyKey))
+	e.PUT("/orders", orderHandler.UpdateOrder, api.Idempotency(idempotencyStore, api.OrderIdempotencyKey))
+	e.DELETE("/orders/:id", orderHandler.CancelOrder, ownerOnly, api.Idempotency(idempotencyStore, api.HeaderIdempotencyKey))
+	// line indexes shift when a line is cancelled, so retries must not be
+	// applied twice
+	e.DELETE("/orders/:id/lines/:index", orderHandler.CancelLine, ownerOnly, api.Idempotency(idempotencyStore, api.HeaderIdempotencyKey))
+	e.PATCH("/orders/:id/lines/:index", orderHandler.ReduceLine, ownerOnly, api.Idempotency(idempotencyStore, api.HeaderIdempotencyKey))
+	e.POST("/orders/:id/returns", orderHandler.RequestReturn, ownerOnly, api.Idempotency(idempotencyStore, api.HeaderIdempotencyKey))
+	reviewerOnly := api.RequireRole("admin", "reviewer")
+	e.POST("/orders/:id/returns/:return_id/approve", orderHandler.ApproveReturn, reviewerOnly)
+	e.POST("/orders/:id/returns/:return_id/reject", orderHandler.RejectReturn, reviewerOnly)
+
+	e.POST("/quotes", orderHandler.CreateQuote)
+
+	adminOnly := api.RequireRole("admin")
+	e.GET("/admin/reservations", orderHandler.ListReservations, adminOnly)
+	e.GET("/admin/reservations/:order_id", orderHandler.GetReservation, adminOnly)
+	e.GET("/admin/stock/:product_id", orderHandler.GetStockLevel, adminOnly)
+	e.PUT("/admin/promotions/:code", orderHandler.SavePromotion, adminOnly)
+	e.GET("/admin/promotions/:code", orderHandler.GetPromotion, adminOnly)
+	e.GET("/reports/sales", orderHandler.SalesReport, adminOnly)
 
 	e.Logger.Fatal(e.Start(":8082"))
 
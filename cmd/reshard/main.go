@@ -0,0 +1,507 @@
+// Command reshard moves order data between MySQL shards while the service
+// keeps running.
+//
+// It compares the routing the service uses today (SHARD_* environment plus
+// the topology stored in Redis) with the target given on the command line
+// and, for every slot that changes shard:
+//
+//  1. turns on dual writes so the service mirrors writes to the new shard,
+//  2. copies the slot's orders, then its audit events, in batches,
+//     checkpointing in Redis,
+//  3. verifies row counts and checksums on both shards,
+//  4. fences the moved slots, so the service refuses writes to them, and
+//     waits until every instance acknowledged the fence,
+//  5. verifies the fenced slots again, now that no writes are in flight,
+//  6. flips routing for all moved slots and lifts the fence in a single
+//     topology write.
+//
+// Progress is stored in Redis, so rerunning the command after a crash
+// resumes where it stopped. Once every instance runs with the target SHARD_*
+// configuration, run it again with -finalize (and -cleanup to delete the
+// copies left on the old shards).
+//
+// With -legacy-slots it prints, for every shard, the @shard_slot to apply
+// migrations/003_global_order_ids.sql with under the current routing.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"order-service/internal/config"
+	"order-service/internal/repository"
+	"order-service/internal/sharding"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog"
+)
+
+var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+const stateKey = "reshard:state"
+
+const (
+	phaseDualWrite = "dual_write"
+	phaseCopied    = "copied"
+	phaseVerified  = "verified"
+	phaseFenced    = "fenced"
+	phaseFlipped   = "flipped"
+)
+
+// state is the resumable progress of a resharding run.
+type state struct {
+	Target      string               `json:"target"`
+	Moves       []sharding.SlotRange `json:"moves"`
+	Phase       string               `json:"phase"`
+	Checkpoints map[int]int64        `json:"checkpoints"`
+	// EventCheckpoints is the last audit event copied per slot, by its id
+	// on the old shard.
+	EventCheckpoints map[int]int64 `json:"event_checkpoints"`
+}
+
+type options struct {
+	strategy string
+	shards   int
+	weights  string
+	vnodes   int
+	batch    int
+	settle   time.Duration
+	ack      time.Duration
+	dryRun   bool
+	finalize bool
+	cleanup  bool
+	reset    bool
+	legacy   bool
+}
+
+func main() {
+	opts := options{}
+	flag.StringVar(&opts.strategy, "to-strategy", "consistent", "target shard strategy: modulo or consistent")
+	flag.IntVar(&opts.shards, "to-shards", 0, "target shard count")
+	flag.StringVar(&opts.weights, "to-weights", "", "comma separated shard weights for the consistent strategy")
+	flag.IntVar(&opts.vnodes, "to-vnodes", 160, "virtual nodes per unit of weight for the consistent strategy")
+	flag.IntVar(&opts.batch, "batch", 500, "orders copied per batch")
+	flag.DurationVar(&opts.settle, "settle", 15*time.Second, "time for running instances to pick up a topology change")
+	flag.DurationVar(&opts.ack, "ack-timeout", time.Minute, "how long to wait for every instance to acknowledge the write fence")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "print the moves and row counts without changing anything")
+	flag.BoolVar(&opts.finalize, "finalize", false, "drop routing overrides once every instance runs the target configuration")
+	flag.BoolVar(&opts.cleanup, "cleanup", false, "with -finalize, delete moved rows from their old shards")
+	flag.BoolVar(&opts.reset, "reset", false, "discard saved progress and start over")
+	flag.BoolVar(&opts.legacy, "legacy-slots", false, "print the slot of legacy order IDs per shard under the current routing and exit")
+	flag.Parse()
+
+	if err := run(context.Background(), opts); err != nil {
+		logger.Fatal().Err(err).Msg("resharding failed")
+	}
+}
+
+func run(ctx context.Context, opts options) error {
+	currentCount, err := config.ShardCount()
+	if err != nil {
+		return err
+	}
+	current, err := config.NewShardStrategy(currentCount)
+	if err != nil {
+		return err
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: os.Getenv("REDIS_ADDR"),
+	})
+	topology, err := sharding.LoadTopology(ctx, rdb)
+	if err != nil {
+		return err
+	}
+	currentRouter := sharding.NewShardRouter(current)
+	currentRouter.SetTopology(topology)
+	if opts.legacy {
+		return printLegacySlots(currentRouter, currentCount)
+	}
+
+	if opts.shards <= 0 {
+		return errors.New("-to-shards is required")
+	}
+	target, err := targetStrategy(opts)
+	if err != nil {
+		return err
+	}
+
+	dbShards, err := config.NewMySQLShards(max(currentCount, opts.shards))
+	if err != nil {
+		return err
+	}
+	repo := repository.NewOrderRepository(dbShards, sharding.NewShardRouter(target))
+
+	if opts.reset {
+		if err := rdb.Del(ctx, stateKey).Err(); err != nil {
+			return err
+		}
+	}
+	targetDesc := fmt.Sprintf("%s/%d/%s/%d", target.Name(), target.ShardCount(), opts.weights, opts.vnodes)
+	st, err := loadState(ctx, rdb)
+	if err != nil {
+		return err
+	}
+	if st != nil && st.Target != targetDesc {
+		return fmt.Errorf("a resharding to %s is in progress, finish it or rerun with -reset", st.Target)
+	}
+
+	if opts.finalize {
+		if st == nil || st.Phase != phaseFlipped {
+			return errors.New("nothing to finalize: no flipped resharding in progress")
+		}
+		return finalize(ctx, rdb, repo, st, opts)
+	}
+
+	if st == nil {
+		st = &state{
+			Target:           targetDesc,
+			Moves:            sharding.Moves(currentRouter, target),
+			Checkpoints:      map[int]int64{},
+			EventCheckpoints: map[int]int64{},
+		}
+	}
+	if len(st.Moves) == 0 {
+		logger.Info().Msg("no slot changes shard, nothing to do")
+		return nil
+	}
+
+	if opts.dryRun {
+		return printPlan(repo, st.Moves)
+	}
+
+	if st.Phase == "" {
+		if _, err := updateTopology(ctx, rdb, func(t *sharding.Topology) {
+			forEachSlot(st.Moves, func(slot, from, to int) {
+				t.DualWrite[slot] = to
+			})
+		}); err != nil {
+			return err
+		}
+		logger.Info().Msgf("dual writes enabled, waiting %s for instances to pick them up", opts.settle)
+		time.Sleep(opts.settle)
+		if err := saveState(ctx, rdb, st, phaseDualWrite); err != nil {
+			return err
+		}
+	}
+
+	if st.Phase == phaseDualWrite {
+		if err := copySlots(ctx, rdb, repo, st, st.Moves, opts.batch); err != nil {
+			return err
+		}
+		if err := copySlotEvents(ctx, rdb, repo, st, opts.batch); err != nil {
+			return err
+		}
+		if err := saveState(ctx, rdb, st, phaseCopied); err != nil {
+			return err
+		}
+	}
+
+	if st.Phase == phaseCopied {
+		if err := verifySlots(ctx, rdb, repo, st, opts.batch); err != nil {
+			return err
+		}
+		if err := saveState(ctx, rdb, st, phaseVerified); err != nil {
+			return err
+		}
+	}
+
+	if st.Phase == phaseVerified {
+		// an instance that has not seen the flip would keep writing to the
+		// old shard, and dual writes to the new one race with writes made
+		// there after the flip, so no writes may be in flight across it
+		version, err := updateTopology(ctx, rdb, func(t *sharding.Topology) {
+			forEachSlot(st.Moves, func(slot, from, to int) {
+				t.Fenced[slot] = true
+			})
+		})
+		if err != nil {
+			return err
+		}
+		logger.Info().Msgf("moved slots fenced, waiting up to %s for every instance to acknowledge", opts.ack)
+		if err := sharding.WaitForTopology(ctx, rdb, version, opts.ack); err != nil {
+			return fmt.Errorf("slots stay fenced, rerun to retry: %w", err)
+		}
+		if err := saveState(ctx, rdb, st, phaseFenced); err != nil {
+			return err
+		}
+	}
+
+	if st.Phase == phaseFenced {
+		if err := verifySlots(ctx, rdb, repo, st, opts.batch); err != nil {
+			return fmt.Errorf("slots stay fenced, rerun to retry: %w", err)
+		}
+		// every moved slot is flipped by the same topology write; the old
+		// shard keeps receiving writes until finalize so instances that
+		// have not seen the flip yet stay consistent
+		if _, err := updateTopology(ctx, rdb, func(t *sharding.Topology) {
+			forEachSlot(st.Moves, func(slot, from, to int) {
+				t.Overrides[slot] = to
+				t.DualWrite[slot] = from
+				delete(t.Fenced, slot)
+			})
+		}); err != nil {
+			return err
+		}
+		if err := saveState(ctx, rdb, st, phaseFlipped); err != nil {
+			return err
+		}
+	}
+
+	logger.Info().Msg("routing flipped; deploy the target SHARD_* configuration, then rerun with -finalize")
+	return nil
+}
+
+func targetStrategy(opts options) (sharding.Strategy, error) {
+	switch opts.strategy {
+	case "modulo":
+		return sharding.NewModuloStrategy(opts.shards), nil
+	case "consistent":
+		weights := make([]int, opts.shards)
+		for i := range weights {
+			weights[i] = 1
+		}
+		if opts.weights != "" {
+			parts := strings.Split(opts.weights, ",")
+			if len(parts) != opts.shards {
+				return nil, fmt.Errorf("-to-weights has %d entries, want %d", len(parts), opts.shards)
+			}
+			for i, part := range parts {
+				weight, err := strconv.Atoi(strings.TrimSpace(part))
+				if err != nil {
+					return nil, fmt.Errorf("invalid weight %q: %w", part, err)
+				}
+				weights[i] = weight
+			}
+		}
+		return sharding.NewConsistentHashStrategy(weights, opts.vnodes)
+	default:
+		return nil, fmt.Errorf("unknown strategy %q", opts.strategy)
+	}
+}
+
+// printLegacySlots prints the slot legacy orders of every shard are given,
+// the first slot the routing maps to the shard.
+func printLegacySlots(router *sharding.ShardRouter, shards int) error {
+	for shard := 0; shard < shards; shard++ {
+		slot, ok := sharding.FirstSlot(router, shard)
+		if !ok {
+			return fmt.Errorf("no slot is routed to shard %d, its legacy orders could not be found", shard)
+		}
+		fmt.Printf("shard %d: SET @shard_slot = %d;\n", shard, slot)
+	}
+	return nil
+}
+
+func printPlan(repo *repository.OrderRepository, moves []sharding.SlotRange) error {
+	var slots, orders int64
+	for _, move := range moves {
+		var rangeOrders int64
+		for slot := move.Start; slot < move.End; slot++ {
+			sum, err := repo.ChecksumSlot(move.From, slot)
+			if err != nil {
+				return err
+			}
+			rangeOrders += sum.Orders
+		}
+		fmt.Printf("slots %4d-%4d: shard %d -> shard %d, %d orders\n", move.Start, move.End-1, move.From, move.To, rangeOrders)
+		slots += int64(move.End - move.Start)
+		orders += rangeOrders
+	}
+	fmt.Printf("%d slots and %d orders would move\n", slots, orders)
+	return nil
+}
+
+func copySlots(ctx context.Context, rdb *redis.Client, repo *repository.OrderRepository, st *state, moves []sharding.SlotRange, batch int) error {
+	var copyErr error
+	forEachSlot(moves, func(slot, from, to int) {
+		for copyErr == nil {
+			last, n, err := repo.CopySlotBatch(slot, from, to, st.Checkpoints[slot], batch)
+			if err != nil {
+				copyErr = fmt.Errorf("copy slot %d: %w", slot, err)
+				return
+			}
+			if n == 0 {
+				return
+			}
+			st.Checkpoints[slot] = last
+			if err := saveState(ctx, rdb, st, st.Phase); err != nil {
+				copyErr = err
+				return
+			}
+			logger.Info().Msgf("slot %d: copied %d orders up to %d", slot, n, last)
+		}
+	})
+	return copyErr
+}
+
+// copySlotEvents copies the audit events of every moved slot, including
+// those of orders deleted before the copy. Events written since are
+// mirrored by dual writes.
+func copySlotEvents(ctx context.Context, rdb *redis.Client, repo *repository.OrderRepository, st *state, batch int) error {
+	var copyErr error
+	forEachSlot(st.Moves, func(slot, from, to int) {
+		for copyErr == nil {
+			last, n, err := repo.CopySlotEvents(slot, from, to, st.EventCheckpoints[slot], batch)
+			if err != nil {
+				copyErr = fmt.Errorf("copy events of slot %d: %w", slot, err)
+				return
+			}
+			if n == 0 {
+				return
+			}
+			st.EventCheckpoints[slot] = last
+			if err := saveState(ctx, rdb, st, st.Phase); err != nil {
+				copyErr = err
+				return
+			}
+			logger.Info().Msgf("slot %d: copied %d audit events", slot, n)
+		}
+	})
+	return copyErr
+}
+
+// verifySlots compares every moved slot on both shards. Slots that still
+// differ after a few checks, which allows for in-flight dual writes, are
+// copied again from scratch.
+func verifySlots(ctx context.Context, rdb *redis.Client, repo *repository.OrderRepository, st *state, batch int) error {
+	var verifyErr error
+	forEachSlot(st.Moves, func(slot, from, to int) {
+		if verifyErr != nil {
+			return
+		}
+		for attempt := 1; attempt <= 3; attempt++ {
+			src, err := repo.ChecksumSlot(from, slot)
+			if err != nil {
+				verifyErr = err
+				return
+			}
+			dst, err := repo.ChecksumSlot(to, slot)
+			if err != nil {
+				verifyErr = err
+				return
+			}
+			if src == dst {
+				return
+			}
+			logger.Warn().Msgf("slot %d differs between shard %d %+v and shard %d %+v, recopying", slot, from, src, to, dst)
+			st.Checkpoints[slot] = 0
+			single := []sharding.SlotRange{{Start: slot, End: slot + 1, From: from, To: to}}
+			if err := copySlots(ctx, rdb, repo, st, single, batch); err != nil {
+				verifyErr = err
+				return
+			}
+			time.Sleep(time.Second)
+		}
+		verifyErr = fmt.Errorf("slot %d still differs between shard %d and shard %d", slot, from, to)
+	})
+	return verifyErr
+}
+
+func finalize(ctx context.Context, rdb *redis.Client, repo *repository.OrderRepository, st *state, opts options) error {
+	if _, err := updateTopology(ctx, rdb, func(t *sharding.Topology) {
+		forEachSlot(st.Moves, func(slot, from, to int) {
+			delete(t.Overrides, slot)
+			delete(t.DualWrite, slot)
+		})
+	}); err != nil {
+		return err
+	}
+	if opts.cleanup {
+		logger.Info().Msgf("waiting %s before deleting old copies", opts.settle)
+		time.Sleep(opts.settle)
+		var cleanupErr error
+		forEachSlot(st.Moves, func(slot, from, to int) {
+			for cleanupErr == nil {
+				n, err := repo.DeleteSlotBatch(from, slot, opts.batch)
+				if err != nil {
+					cleanupErr = fmt.Errorf("cleanup slot %d on shard %d: %w", slot, from, err)
+					return
+				}
+				if n == 0 {
+					return
+				}
+			}
+		})
+		if cleanupErr != nil {
+			return cleanupErr
+		}
+	}
+	logger.Info().Msg("resharding finalized")
+	return rdb.Del(ctx, stateKey).Err()
+}
+
+// updateTopology applies change to the stored topology as one write,
+// retrying when another writer got there first, and returns the version
+// written.
+func updateTopology(ctx context.Context, rdb *redis.Client, change func(t *sharding.Topology)) (int64, error) {
+	for {
+		t, err := sharding.LoadTopology(ctx, rdb)
+		if err != nil {
+			return 0, err
+		}
+		if t.Overrides == nil {
+			t.Overrides = map[int]int{}
+		}
+		if t.DualWrite == nil {
+			t.DualWrite = map[int]int{}
+		}
+		if t.Fenced == nil {
+			t.Fenced = map[int]bool{}
+		}
+		change(t)
+		err = sharding.SaveTopology(ctx, rdb, t)
+		if errors.Is(err, sharding.ErrTopologyChanged) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		logger.Info().Msgf("saved shard topology version %d", t.Version)
+		return t.Version, nil
+	}
+}
+
+func forEachSlot(moves []sharding.SlotRange, fn func(slot, from, to int)) {
+	for _, move := range moves {
+		for slot := move.Start; slot < move.End; slot++ {
+			fn(slot, move.From, move.To)
+		}
+	}
+}
+
+func loadState(ctx context.Context, rdb *redis.Client) (*state, error) {
+	raw, err := rdb.Get(ctx, stateKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := &state{}
+	if err := json.Unmarshal(raw, st); err != nil {
+		return nil, err
+	}
+	if st.Checkpoints == nil {
+		st.Checkpoints = map[int]int64{}
+	}
+	if st.EventCheckpoints == nil {
+		st.EventCheckpoints = map[int]int64{}
+	}
+	return st, nil
+}
+
+func saveState(ctx context.Context, rdb *redis.Client, st *state, phase string) error {
+	st.Phase = phase
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return rdb.Set(ctx, stateKey, raw, 0).Err()
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// actorFromContext identifies the caller from the JWT set by the echojwt
+// middleware, preferring the "sub" claim over "user_id".
+func actorFromContext(c echo.Context) string {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return "anonymous"
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "anonymous"
+	}
+	for _, name := range []string{"sub", "user_id"} {
+		if value, ok := claims[name]; ok && value != nil {
+			if f, ok := value.(float64); ok {
+				return fmt.Sprintf("user:%d", int64(f))
+			}
+			return fmt.Sprintf("user:%v", value)
+		}
+	}
+	return "anonymous"
+}
+
+// userIDFromContext reads the numeric user ID of the caller from the
+// "user_id" or "sub" claim of the JWT.
+func userIDFromContext(c echo.Context) (int, bool) {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return 0, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, false
+	}
+	for _, name := range []string{"user_id", "sub"} {
+		switch value := claims[name].(type) {
+		case float64:
+			return int(value), true
+		case string:
+			if id, err := strconv.Atoi(value); err == nil {
+				return id, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// RequireRole lets a request through only when the JWT of the caller grants
+// one of roles, in its "role" claim or its "roles" list.
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !hasRole(c, roles...) {
+				return c.JSON(403, map[string]string{"error": "forbidden"})
+			}
+			return next(c)
+		}
+	}
+}
+
+// hasRole reports whether the JWT of the caller grants one of roles.
+func hasRole(c echo.Context, roles ...string) bool {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	var granted []interface{}
+	switch value := claims["roles"].(type) {
+	case []interface{}:
+		granted = value
+	case string:
+		granted = append(granted, value)
+	}
+	if role, ok := claims["role"]; ok {
+		granted = append(granted, role)
+	}
+	for _, g := range granted {
+		for _, role := range roles {
+			if g == role {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -4,11 +4,16 @@ package api
 import (
 	"order-service/internal/entity"
 	"order-service/internal/service"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
 )
 
+var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+
 type OrderHandler struct {
 	orderService service.OrderService
 }
@@ -25,38 +30,165 @@ func (h *OrderHandler) CreateOrder(c echo.Context) error {
 	if err := c.Bind(&order); err != nil {
 		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
 	}
+	// orders are placed for the caller; the order ID is derived from them
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return c.JSON(401, map[string]string{"error": "token has no user"})
+	}
+	if order.UserID != 0 && order.UserID != userID {
+		return c.JSON(403, map[string]string{"error": "cannot place orders for another user"})
+	}
+	order.UserID = userID
 
-	createdOrder, err := h.orderService.CreateOrder(ctx, &order)
+	createdOrder, err := h.orderService.CreateOrder(ctx, &order, actorFromContext(c))
 	if err != nil {
-		return c.JSON(500, map[string]string{"error": err.Error()})
+		return errorResponse(c, err)
 	}
-	return c.JSON(200, createdOrder)
+	return orderResponse(c, 200, createdOrder)
+
+}
 
+// updateOrderRequest is the PUT /orders payload: the order plus the reason
+// recorded when the update changes the order status. The version the
+// update was made against comes from If-Match or the version field.
+type updateOrderRequest struct {
+	entity.OrderEntity
+	Reason string `json:"reason"`
 }
+
 func (h *OrderHandler) UpdateOrder(c echo.Context) error {
 	ctx := c.Request().Context()
-	order := entity.OrderEntity{}
-	if err := c.Bind(&order); err != nil {
+	req := updateOrderRequest{}
+	if err := c.Bind(&req); err != nil {
 		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
 	}
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if version != 0 {
+		if req.Version != 0 && req.Version != version {
+			return c.JSON(400, map[string]string{"error": "If-Match and version disagree"})
+		}
+		req.Version = version
+	}
+	if err := h.checkOwner(c, req.OrderID); err != nil {
+		return errorResponse(c, err)
+	}
 
-	updatedOrder, err := h.orderService.UpdateOrder(ctx, &order)
+	updatedOrder, err := h.orderService.UpdateOrder(ctx, &req.OrderEntity, actorFromContext(c), req.Reason)
 	if err != nil {
-		return c.JSON(500, map[string]string{"error": err.Error()})
+		return errorResponse(c, err)
 	}
-	return c.JSON(200, updatedOrder)
+	return orderResponse(c, 200, updatedOrder)
 }
 
 func (h *OrderHandler) CancelOrder(c echo.Context) error {
 	ctx := c.Request().Context()
 	id := c.Param("id")
-	idInt, err := strconv.Atoi(id)
+	orderID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+	order, err := h.orderService.CancelOrder(ctx, orderID, actorFromContext(c), c.QueryParam("reason"))
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return orderResponse(c, 200, order)
+}
+
+func (h *OrderHandler) GetOrder(c echo.Context) error {
+	ctx := c.Request().Context()
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		return c.JSON(400, map[string]string{"error": "Invalid ID"})
 	}
-	order, err := h.orderService.CancelOrder(ctx, idInt)
+	order, err := h.orderService.GetOrder(ctx, orderID)
 	if err != nil {
-		return c.JSON(500, map[string]string{"error": err.Error()})
+		return errorResponse(c, err)
+	}
+	return orderResponse(c, 200, order)
+}
+
+func (h *OrderHandler) ListStatusTransitions(c echo.Context) error {
+	ctx := c.Request().Context()
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+	transitions, err := h.orderService.ListStatusTransitions(ctx, orderID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, transitions)
+}
+
+func (h *OrderHandler) OrderHistory(c echo.Context) error {
+	ctx := c.Request().Context()
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+	events, err := h.orderService.OrderHistory(ctx, orderID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, events)
+}
+
+// GetCheckout returns the checkout saga of an order, to see how far its
+// checkout got or why it was compensated.
+func (h *OrderHandler) GetCheckout(c echo.Context) error {
+	ctx := c.Request().Context()
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+	saga, err := h.orderService.GetCheckout(ctx, orderID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, saga)
+}
+
+func (h *OrderHandler) ListOrders(c echo.Context) error {
+	ctx := c.Request().Context()
+	// callers only ever see their own orders
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return c.JSON(401, map[string]string{"error": "token has no user"})
+	}
+	var err error
+	filter := entity.OrderFilter{
+		UserID: userID,
+		Status: entity.OrderStatus(c.QueryParam("status")),
+	}
+	if filter.From, err = parseDateParam(c.QueryParam("from")); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid from date"})
+	}
+	if filter.To, err = parseDateParam(c.QueryParam("to")); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid to date"})
+	}
+	if limit := c.QueryParam("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			return c.JSON(400, map[string]string{"error": "Invalid limit"})
+		}
+	}
+
+	page, err := h.orderService.ListOrders(ctx, filter, c.QueryParam("cursor"))
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, page)
+}
+
+// parseDateParam accepts either a full RFC3339 timestamp or a plain date.
+func parseDateParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
 	}
-	return c.JSON(200, order)
+	return time.Parse(time.DateOnly, value)
 }
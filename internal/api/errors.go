@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"order-service/internal/entity"
+
+	"github.com/labstack/echo/v4"
+)
+
+// errorResponse maps service errors to HTTP status codes. Errors that are
+// not recognised are reported as 500.
+func errorResponse(c echo.Context, err error) error {
+	var transitionErr *entity.TransitionError
+	var linesErr *entity.OrderLinesError
+	switch {
+	case errors.As(err, &linesErr):
+		code := 422
+		if linesErr.OnlyOutOfStock() {
+			code = 409
+		}
+		return c.JSON(code, map[string]interface{}{"error": "order lines rejected", "lines": linesErr.Lines})
+	case errors.Is(err, entity.ErrOrderNotFound), errors.Is(err, entity.ErrReservationNotActive), errors.Is(err, entity.ErrLineNotFound),
+		errors.Is(err, entity.ErrSagaNotFound), errors.Is(err, entity.ErrReturnNotFound):
+		return c.JSON(404, map[string]string{"error": err.Error()})
+	case errors.Is(err, entity.ErrInvalidCursor), errors.Is(err, entity.ErrInvalidStatus), errors.Is(err, entity.ErrInvalidPromotion):
+		return c.JSON(400, map[string]string{"error": err.Error()})
+	case errors.Is(err, entity.ErrProductNotFound), errors.Is(err, entity.ErrInvalidQuote), errors.Is(err, entity.ErrQuoteExpired),
+		errors.Is(err, entity.ErrUnsupportedCurrency), errors.Is(err, entity.ErrCouponNotFound), errors.Is(err, entity.ErrCouponNotApplicable),
+		errors.Is(err, entity.ErrNoTaxRule), errors.Is(err, entity.ErrInvalidQuantity), errors.Is(err, entity.ErrTotalsMismatch),
+		errors.Is(err, entity.ErrAmountOverflow), errors.Is(err, entity.ErrCurrencyMismatch):
+		return c.JSON(422, map[string]string{"error": err.Error()})
+	case errors.Is(err, entity.ErrPaymentStatus):
+		return c.JSON(403, map[string]string{"error": err.Error()})
+	case errors.Is(err, entity.ErrVersionMismatch):
+		return c.JSON(412, map[string]string{"error": err.Error()})
+	case errors.Is(err, entity.ErrVersionRequired):
+		return c.JSON(428, map[string]string{"error": err.Error()})
+	case errors.Is(err, entity.ErrUpstreamUnavailable), errors.Is(err, entity.ErrShardMoving):
+		return c.JSON(503, map[string]string{"error": err.Error()})
+	case errors.As(err, &transitionErr), errors.Is(err, entity.ErrStatusChanged), errors.Is(err, entity.ErrSagaChanged), errors.Is(err, entity.ErrOutOfStock),
+		errors.Is(err, entity.ErrCouponLimitReached), errors.Is(err, entity.ErrLineChangeNotAllowed),
+		errors.Is(err, entity.ErrRegionChangeNotAllowed), errors.Is(err, entity.ErrReturnNotAllowed):
+		return c.JSON(409, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(500, map[string]string{"error": err.Error()})
+}
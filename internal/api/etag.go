@@ -0,0 +1,34 @@
+package api
+
+import (
+	"errors"
+	"order-service/internal/entity"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// orderResponse writes an order with its version as the ETag.
+func orderResponse(c echo.Context, code int, order *entity.OrderEntity) error {
+	c.Response().Header().Set("ETag", strconv.Quote(strconv.FormatInt(order.Version, 10)))
+	return c.JSON(code, order)
+}
+
+// ifMatchVersion reads the order version from the If-Match header. It
+// returns zero when the header is not set.
+func ifMatchVersion(c echo.Context) (int64, error) {
+	value := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+	if value == "" {
+		return 0, nil
+	}
+	value = strings.TrimPrefix(value, "W/")
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, errors.New("If-Match must be the ETag of the order")
+	}
+	return version, nil
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"order-service/internal/idempotency"
+
+	"github.com/labstack/echo/v4"
+)
+
+const headerIdempotencyKey = "Idempotency-Key"
+
+// IdempotencyKeyFunc extracts the idempotency key of a request. An empty
+// key turns idempotency off for the request.
+type IdempotencyKeyFunc func(c echo.Context, body []byte) string
+
+// HeaderIdempotencyKey reads the Idempotency-Key header.
+func HeaderIdempotencyKey(c echo.Context, body []byte) string {
+	return c.Request().Header.Get(headerIdempotencyKey)
+}
+
+// OrderIdempotencyKey reads the Idempotency-Key header and falls back to
+// the idempotent_key field of an order payload.
+func OrderIdempotencyKey(c echo.Context, body []byte) string {
+	if key := HeaderIdempotencyKey(c, body); key != "" {
+		return key
+	}
+	var payload struct {
+		IdempotentKey string `json:"idempotent_key"`
+	}
+	json.Unmarshal(body, &payload)
+	return payload.IdempotentKey
+}
+
+// Idempotency makes a route safe to retry. The first request with a key
+// runs the handler and, when it succeeds, its response is stored per user
+// and key; a later request with the same key and payload gets the stored
+// response back. A different payload under the same key is rejected with
+// 422, and a retry while the first request is still running with 409.
+// Failed requests release the key so they can be retried.
+func Idempotency(store *idempotency.Store, keyFunc IdempotencyKeyFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			key := keyFunc(c, body)
+			if key == "" {
+				return next(c)
+			}
+			ctx := req.Context()
+			user := actorFromContext(c)
+			fingerprint := requestFingerprint(req, body)
+
+			existing, err := store.Begin(ctx, user, key, fingerprint)
+			if err != nil {
+				return c.JSON(500, map[string]string{"error": err.Error()})
+			}
+			if existing != nil {
+				switch {
+				case existing.Fingerprint != fingerprint:
+					return c.JSON(422, map[string]string{"error": "idempotency key already used with a different request"})
+				case existing.Status == idempotency.StatusInProgress:
+					return c.JSON(409, map[string]string{"error": "request with this idempotency key is in progress"})
+				}
+				c.Response().Header().Set("Idempotent-Replayed", "true")
+				if existing.ETag != "" {
+					c.Response().Header().Set("ETag", existing.ETag)
+				}
+				return c.Blob(existing.StatusCode, existing.ContentType, existing.Body)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			err = next(c)
+			status := c.Response().Status
+			if err != nil || status < 200 || status >= 300 {
+				if abortErr := store.Abort(ctx, user, key); abortErr != nil {
+					logger.Error().Err(abortErr).Msgf("error releasing idempotency key %s", key)
+				}
+				return err
+			}
+			err = store.Complete(ctx, user, key, idempotency.Record{
+				Fingerprint: fingerprint,
+				StatusCode:  status,
+				ContentType: c.Response().Header().Get(echo.HeaderContentType),
+				ETag:        c.Response().Header().Get("ETag"),
+				Body:        recorder.body.Bytes(),
+			})
+			if err != nil {
+				logger.Error().Err(err).Msgf("error storing response for idempotency key %s", key)
+			}
+			return nil
+		}
+	}
+}
+
+// requestFingerprint identifies what a request asks for, so a key reused
+// for a different request can be told apart from a retry.
+func requestFingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.Path + "?" + req.URL.RawQuery + "\n"))
+	// updates against another version are different requests
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+		h.Write([]byte("If-Match: " + ifMatch + "\n"))
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body while writing it.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
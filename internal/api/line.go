@@ -0,0 +1,64 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// reduceLineRequest is the PATCH /orders/:id/lines/:index payload.
+type reduceLineRequest struct {
+	Quantity int    `json:"quantity"`
+	Reason   string `json:"reason"`
+}
+
+func (h *OrderHandler) CancelLine(c echo.Context) error {
+	ctx := c.Request().Context()
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid line index"})
+	}
+	order, err := h.orderService.CancelLine(ctx, orderID, index, actorFromContext(c), c.QueryParam("reason"))
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return orderResponse(c, 200, order)
+}
+
+func (h *OrderHandler) ReduceLine(c echo.Context) error {
+	ctx := c.Request().Context()
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid line index"})
+	}
+	req := reduceLineRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+	order, err := h.orderService.ReduceLine(ctx, orderID, index, req.Quantity, actorFromContext(c), req.Reason)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return orderResponse(c, 200, order)
+}
+
+func (h *OrderHandler) ListLineChanges(c echo.Context) error {
+	ctx := c.Request().Context()
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+	changes, err := h.orderService.ListLineChanges(ctx, orderID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, changes)
+}
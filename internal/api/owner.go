@@ -0,0 +1,43 @@
+package api
+
+import (
+	"order-service/internal/entity"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequireOwner lets a request at /orders/:id through only when the order
+// belongs to the caller, or the caller is an admin.
+func (h *OrderHandler) RequireOwner(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			return c.JSON(400, map[string]string{"error": "Invalid ID"})
+		}
+		if err := h.checkOwner(c, orderID); err != nil {
+			return errorResponse(c, err)
+		}
+		return next(c)
+	}
+}
+
+// checkOwner fails with entity.ErrOrderNotFound when the order belongs to
+// someone else, so other users' order IDs cannot be told from missing ones.
+func (h *OrderHandler) checkOwner(c echo.Context, orderID int64) error {
+	if hasRole(c, "admin") {
+		return nil
+	}
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return entity.ErrOrderNotFound
+	}
+	order, err := h.orderService.GetOrder(c.Request().Context(), orderID)
+	if err != nil {
+		return err
+	}
+	if order.UserID != userID {
+		return entity.ErrOrderNotFound
+	}
+	return nil
+}
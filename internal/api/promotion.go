@@ -0,0 +1,29 @@
+package api
+
+import (
+	"order-service/internal/entity"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (h *OrderHandler) SavePromotion(c echo.Context) error {
+	ctx := c.Request().Context()
+	promotion := entity.Promotion{}
+	if err := c.Bind(&promotion); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+	promotion.Code = c.Param("code")
+	if err := h.orderService.SavePromotion(ctx, &promotion); err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, promotion)
+}
+
+func (h *OrderHandler) GetPromotion(c echo.Context) error {
+	ctx := c.Request().Context()
+	promotion, err := h.orderService.GetPromotion(ctx, c.Param("code"))
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, promotion)
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"order-service/internal/entity"
+
+	"github.com/labstack/echo/v4"
+)
+
+// createQuoteRequest is the POST /quotes payload, the cart to be priced.
+type createQuoteRequest struct {
+	UserID          int                     `json:"user_id"`
+	Currency        string                  `json:"currency"`
+	ProductRequests []entity.ProductRequest `json:"product_requests"`
+}
+
+func (h *OrderHandler) CreateQuote(c echo.Context) error {
+	ctx := c.Request().Context()
+	req := createQuoteRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+	if len(req.ProductRequests) == 0 {
+		return c.JSON(400, map[string]string{"error": "Quote needs at least one product"})
+	}
+	// a quote is only good for orders of the user it was made for
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return c.JSON(401, map[string]string{"error": "token has no user"})
+	}
+	if req.UserID != 0 && req.UserID != userID {
+		return c.JSON(403, map[string]string{"error": "cannot quote for another user"})
+	}
+	req.UserID = userID
+
+	quote, err := h.orderService.CreateQuote(ctx, req.UserID, req.Currency, req.ProductRequests)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, quote)
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+func (h *OrderHandler) SalesReport(c echo.Context) error {
+	ctx := c.Request().Context()
+	from, err := parseDateParam(c.QueryParam("from"))
+	if err != nil || from.IsZero() {
+		return c.JSON(400, map[string]string{"error": "Invalid from date"})
+	}
+	to, err := parseDateParam(c.QueryParam("to"))
+	if err != nil || to.IsZero() {
+		return c.JSON(400, map[string]string{"error": "Invalid to date"})
+	}
+	report, err := h.orderService.SalesReport(ctx, from, to)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, report)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (h *OrderHandler) ListReservations(c echo.Context) error {
+	ctx := c.Request().Context()
+	offset, _ := strconv.Atoi(c.QueryParam("offset"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	reservations, err := h.orderService.ListReservations(ctx, offset, limit)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, reservations)
+}
+
+func (h *OrderHandler) GetReservation(c echo.Context) error {
+	ctx := c.Request().Context()
+	orderID, err := strconv.ParseInt(c.Param("order_id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid order ID"})
+	}
+	reservation, err := h.orderService.GetReservation(ctx, orderID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, reservation)
+}
+
+func (h *OrderHandler) GetStockLevel(c echo.Context) error {
+	ctx := c.Request().Context()
+	productID, err := strconv.Atoi(c.Param("product_id"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid product ID"})
+	}
+	level, err := h.orderService.GetStockLevel(ctx, productID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, level)
+}
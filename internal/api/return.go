@@ -0,0 +1,82 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// returnRequest is the POST /orders/:id/returns payload.
+type returnRequest struct {
+	LineIndex int    `json:"line_index"`
+	Quantity  int    `json:"quantity"`
+	Reason    string `json:"reason"`
+}
+
+// reviewReturnRequest is the payload of approving or rejecting a return.
+type reviewReturnRequest struct {
+	Note string `json:"note"`
+}
+
+func (h *OrderHandler) RequestReturn(c echo.Context) error {
+	ctx := c.Request().Context()
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+	req := returnRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+	ret, err := h.orderService.RequestReturn(ctx, orderID, req.LineIndex, req.Quantity, actorFromContext(c), req.Reason)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(201, ret)
+}
+
+func (h *OrderHandler) ListReturns(c echo.Context) error {
+	ctx := c.Request().Context()
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+	returns, err := h.orderService.ListReturns(ctx, orderID)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, returns)
+}
+
+func (h *OrderHandler) ApproveReturn(c echo.Context) error {
+	return h.reviewReturn(c, true)
+}
+
+func (h *OrderHandler) RejectReturn(c echo.Context) error {
+	return h.reviewReturn(c, false)
+}
+
+func (h *OrderHandler) reviewReturn(c echo.Context, approve bool) error {
+	ctx := c.Request().Context()
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+	returnID, err := strconv.ParseInt(c.Param("return_id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid return ID"})
+	}
+	req := reviewReturnRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+	review := h.orderService.RejectReturn
+	if approve {
+		review = h.orderService.ApproveReturn
+	}
+	ret, err := review(ctx, orderID, returnID, actorFromContext(c), req.Note)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(200, ret)
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// batchWorkers bounds the concurrent single-item calls made when an
+// upstream has no batch endpoint.
+const batchWorkers = 8
+
+// batchSupport remembers whether an upstream's batch endpoint exists, so the
+// fallback is not probed on every call.
+type batchSupport struct {
+	mu          sync.Mutex
+	unsupported bool
+}
+
+func (b *batchSupport) supported() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.unsupported
+}
+
+// check marks the batch endpoint unsupported when err says the route does
+// not exist, and reports whether that happened.
+func (b *batchSupport) check(err error) bool {
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) {
+		return false
+	}
+	if upstreamErr.StatusCode != http.StatusNotFound && upstreamErr.StatusCode != http.StatusMethodNotAllowed {
+		return false
+	}
+	b.mu.Lock()
+	b.unsupported = true
+	b.mu.Unlock()
+	return true
+}
+
+// uniqueIDs drops repeated product IDs, keeping the first occurrence order.
+func uniqueIDs(productIDs []int) []int {
+	seen := make(map[int]bool, len(productIDs))
+	unique := make([]int, 0, len(productIDs))
+	for _, id := range productIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// forEachBounded calls fn for every product ID with at most batchWorkers
+// calls in flight, and returns the first error.
+func forEachBounded(ctx context.Context, productIDs []int, fn func(ctx context.Context, productID int) error) error {
+	sem := make(chan struct{}, batchWorkers)
+	errCh := make(chan error, len(productIDs))
+	var wg sync.WaitGroup
+	for _, productID := range productIDs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func(productID int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, productID); err != nil {
+				errCh <- err
+			}
+		}(productID)
+	}
+	wg.Wait()
+	close(errCh)
+	return <-errCh
+}
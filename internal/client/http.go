@@ -0,0 +1,175 @@
+// Package client calls the product and pricing services with per-call
+// deadlines, retries and a circuit breaker per upstream.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"order-service/internal/entity"
+	"time"
+)
+
+// UpstreamError describes a failed call. It wraps
+// entity.ErrUpstreamUnavailable for outages and entity.ErrProductNotFound
+// for unknown products.
+type UpstreamError struct {
+	Upstream   string
+	StatusCode int
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: status %d: %v", e.Upstream, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Upstream, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+type Options struct {
+	// Timeout bounds every attempt, on top of the caller's context.
+	Timeout time.Duration
+	// MaxRetries is the number of extra attempts for idempotent calls.
+	MaxRetries int
+	// BaseBackoff is the backoff before the first retry; it doubles on
+	// every retry and is jittered.
+	BaseBackoff      time.Duration
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout:          2 * time.Second,
+		MaxRetries:       2,
+		BaseBackoff:      50 * time.Millisecond,
+		FailureThreshold: 5,
+		OpenTimeout:      10 * time.Second,
+	}
+}
+
+// httpClient is the transport shared by the typed clients. Each instance
+// talks to one upstream and owns its circuit breaker.
+type httpClient struct {
+	name    string
+	baseURL string
+	http    *http.Client
+	breaker *CircuitBreaker
+	opts    Options
+}
+
+func newHTTPClient(name, baseURL string, opts Options) *httpClient {
+	return &httpClient{
+		name:    name,
+		baseURL: baseURL,
+		http:    &http.Client{},
+		breaker: NewCircuitBreaker(opts.FailureThreshold, opts.OpenTimeout),
+		opts:    opts,
+	}
+}
+
+// do sends a request and decodes a 200 response into out. Idempotent calls
+// are retried on network errors and 5xx responses.
+func (c *httpClient) do(ctx context.Context, method, path string, body, out interface{}, idempotent bool) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	attempts := 1
+	if idempotent {
+		attempts += c.opts.MaxRetries
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if waitErr := sleep(ctx, c.backoff(attempt)); waitErr != nil {
+				break
+			}
+		}
+		var retryable bool
+		retryable, err = c.attempt(ctx, method, path, payload, out)
+		if err == nil || !retryable {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *httpClient) attempt(ctx context.Context, method, path string, payload []byte, out interface{}) (bool, error) {
+	callCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(callCtx, method, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if !c.breaker.Allow() {
+		return false, &UpstreamError{Upstream: c.name, Err: fmt.Errorf("%w: circuit open", entity.ErrUpstreamUnavailable)}
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			// the caller gave up, which says nothing about the upstream
+			c.breaker.Abandon()
+			return false, ctx.Err()
+		}
+		c.breaker.Failure()
+		return true, &UpstreamError{Upstream: c.name, Err: fmt.Errorf("%w: %v", entity.ErrUpstreamUnavailable, err)}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		c.breaker.Success()
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return false, &UpstreamError{Upstream: c.name, StatusCode: resp.StatusCode, Err: fmt.Errorf("decode response: %w", err)}
+		}
+		return false, nil
+	case resp.StatusCode == http.StatusNotFound:
+		// the upstream answered, so it is healthy
+		c.breaker.Success()
+		io.Copy(io.Discard, resp.Body)
+		return false, &UpstreamError{Upstream: c.name, StatusCode: resp.StatusCode, Err: entity.ErrProductNotFound}
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		c.breaker.Failure()
+		io.Copy(io.Discard, resp.Body)
+		return true, &UpstreamError{Upstream: c.name, StatusCode: resp.StatusCode, Err: entity.ErrUpstreamUnavailable}
+	default:
+		c.breaker.Success()
+		io.Copy(io.Discard, resp.Body)
+		return false, &UpstreamError{Upstream: c.name, StatusCode: resp.StatusCode, Err: errors.New("unexpected response")}
+	}
+}
+
+// backoff returns the jittered wait before the given retry.
+func (c *httpClient) backoff(attempt int) time.Duration {
+	d := c.opts.BaseBackoff << (attempt - 1)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"order-service/internal/entity"
+	"sync"
+)
+
+type PricingClient interface {
+	GetPricing(ctx context.Context, productID int) (*entity.Pricing, error)
+	// GetPricings returns the pricing of every product, keyed by product ID.
+	// Products the pricing service does not know are left out.
+	GetPricings(ctx context.Context, productIDs []int) (map[int]*entity.Pricing, error)
+}
+
+type HTTPPricingClient struct {
+	http  *httpClient
+	batch batchSupport
+}
+
+func NewPricingClient(baseURL string, opts Options) *HTTPPricingClient {
+	return &HTTPPricingClient{
+		http: newHTTPClient("pricing-service", baseURL, opts),
+	}
+}
+
+func (c *HTTPPricingClient) GetPricing(ctx context.Context, productID int) (*entity.Pricing, error) {
+	var pricing entity.Pricing
+	err := c.http.do(ctx, http.MethodGet, fmt.Sprintf("/products/%d/pricing", productID), nil, &pricing, true)
+	if err != nil {
+		return nil, err
+	}
+	return &pricing, nil
+}
+
+// GetPricings uses POST /products/pricing/batch and falls back to one call
+// per product when the pricing service does not have that endpoint.
+func (c *HTTPPricingClient) GetPricings(ctx context.Context, productIDs []int) (map[int]*entity.Pricing, error) {
+	productIDs = uniqueIDs(productIDs)
+	if c.batch.supported() {
+		var pricings []entity.Pricing
+		body := map[string][]int{"product_ids": productIDs}
+		err := c.http.do(ctx, http.MethodPost, "/products/pricing/batch", body, &pricings, true)
+		if err == nil {
+			result := make(map[int]*entity.Pricing, len(pricings))
+			for i := range pricings {
+				result[pricings[i].ProductID] = &pricings[i]
+			}
+			return result, nil
+		}
+		if !c.batch.check(err) {
+			return nil, err
+		}
+	}
+
+	var mu sync.Mutex
+	result := make(map[int]*entity.Pricing, len(productIDs))
+	err := forEachBounded(ctx, productIDs, func(ctx context.Context, productID int) error {
+		pricing, err := c.GetPricing(ctx, productID)
+		if errors.Is(err, entity.ErrProductNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		result[productID] = pricing
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"order-service/internal/entity"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+// lastKnownTTL bounds how old a fallback price can get.
+const lastKnownTTL = 24 * time.Hour
+
+// cachedPricing is the value stored under a pricing cache key.
+type cachedPricing struct {
+	Pricing entity.Pricing `json:"pricing"`
+	// Delta is how long the upstream call that produced the entry took, in
+	// milliseconds. Entries that are expensive to rebuild refresh earlier.
+	Delta int64 `json:"delta"`
+	// Expiry is when the entry expires, in Unix milliseconds.
+	Expiry int64 `json:"expiry"`
+}
+
+// refreshEarly decides whether a caller should rebuild the entry before it
+// expires (XFetch). The chance grows as the expiry approaches, so one caller
+// usually refreshes a hot entry ahead of time instead of all of them at once
+// after it expired.
+func (e *cachedPricing) refreshEarly(now time.Time, beta float64) bool {
+	gap := -float64(e.Delta) * beta * math.Log(1-rand.Float64())
+	return float64(now.UnixMilli())+gap >= float64(e.Expiry)
+}
+
+// CachedPricingClient is a read-through Redis cache in front of a
+// PricingClient. Misses are fetched one product at a time, and concurrent
+// misses for the same product are coalesced into one upstream call per
+// instance. When the pricing service is unavailable the last known price
+// is returned with Pricing.Stale set.
+type CachedPricingClient struct {
+	next   PricingClient
+	rdb    *redis.Client
+	ttl    time.Duration
+	beta   float64
+	flight singleflight.Group
+}
+
+func NewCachedPricingClient(next PricingClient, rdb *redis.Client, ttl time.Duration) *CachedPricingClient {
+	return &CachedPricingClient{
+		next: next,
+		rdb:  rdb,
+		ttl:  ttl,
+		beta: 1,
+	}
+}
+
+func pricingCacheKey(productID int) string {
+	return fmt.Sprintf("pricing:cache:%d", productID)
+}
+
+func pricingLastKey(productID int) string {
+	return fmt.Sprintf("pricing:last:%d", productID)
+}
+
+func (c *CachedPricingClient) GetPricing(ctx context.Context, productID int) (*entity.Pricing, error) {
+	pricings, err := c.GetPricings(ctx, []int{productID})
+	if err != nil {
+		return nil, err
+	}
+	pricing, ok := pricings[productID]
+	if !ok {
+		return nil, &UpstreamError{Upstream: "pricing-service", Err: entity.ErrProductNotFound}
+	}
+	return pricing, nil
+}
+
+func (c *CachedPricingClient) GetPricings(ctx context.Context, productIDs []int) (map[int]*entity.Pricing, error) {
+	productIDs = uniqueIDs(productIDs)
+	// a Redis failure is treated as a miss, the cache must not fail orders
+	cached, _ := c.load(ctx, productIDs, pricingCacheKey)
+
+	now := time.Now()
+	result := make(map[int]*entity.Pricing, len(productIDs))
+	var missing []int
+	for _, productID := range productIDs {
+		entry, ok := cached[productID]
+		if ok && !entry.refreshEarly(now, c.beta) {
+			result[productID] = &entry.Pricing
+			continue
+		}
+		missing = append(missing, productID)
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	fetched, err := c.fetch(ctx, missing)
+	if err == nil {
+		for _, productID := range missing {
+			if pricing, ok := fetched[productID]; ok {
+				result[productID] = pricing
+			}
+		}
+		return result, nil
+	}
+	if !errors.Is(err, entity.ErrUpstreamUnavailable) {
+		return nil, err
+	}
+
+	// entries picked for an early refresh are still valid; anything else
+	// falls back to the last known price
+	lastKnown, _ := c.load(ctx, missing, pricingLastKey)
+	for _, productID := range missing {
+		if entry, ok := cached[productID]; ok {
+			result[productID] = &entry.Pricing
+			continue
+		}
+		entry, ok := lastKnown[productID]
+		if !ok {
+			return nil, err
+		}
+		entry.Pricing.Stale = true
+		result[productID] = &entry.Pricing
+	}
+	return result, nil
+}
+
+// Invalidate drops the cached pricing of the given products. Their last
+// known prices are kept as a fallback.
+func (c *CachedPricingClient) Invalidate(ctx context.Context, productIDs ...int) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+	keys := make([]string, len(productIDs))
+	for i, productID := range productIDs {
+		keys[i] = pricingCacheKey(productID)
+	}
+	return c.rdb.Del(ctx, keys...).Err()
+}
+
+// fetch calls the pricing service for the given products, one call per
+// product, and stores the results. A product another request is already
+// fetching is not asked for again; the call waits for that request instead.
+// Products the pricing service does not know are left out.
+func (c *CachedPricingClient) fetch(ctx context.Context, productIDs []int) (map[int]*entity.Pricing, error) {
+	var mu sync.Mutex
+	result := make(map[int]*entity.Pricing, len(productIDs))
+	err := forEachBounded(ctx, productIDs, func(ctx context.Context, productID int) error {
+		// the shared call must not be cancelled when the caller that
+		// started it gives up, because other callers may still wait for it
+		ch := c.flight.DoChan(strconv.Itoa(productID), func() (interface{}, error) {
+			return c.fetchOne(context.WithoutCancel(ctx), productID)
+		})
+		select {
+		case res := <-ch:
+			if res.Err != nil {
+				return res.Err
+			}
+			if pricing := res.Val.(*entity.Pricing); pricing != nil {
+				mu.Lock()
+				result[productID] = pricing
+				mu.Unlock()
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// fetchOne returns nil without an error for an unknown product.
+func (c *CachedPricingClient) fetchOne(ctx context.Context, productID int) (*entity.Pricing, error) {
+	start := time.Now()
+	pricing, err := c.next.GetPricing(ctx, productID)
+	if errors.Is(err, entity.ErrProductNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.store(ctx, map[int]*entity.Pricing{productID: pricing}, time.Since(start))
+	return pricing, nil
+}
+
+// store writes fresh pricing to the cache and to the last known prices.
+// Errors are ignored: the next read simply misses.
+func (c *CachedPricingClient) store(ctx context.Context, pricings map[int]*entity.Pricing, delta time.Duration) {
+	expiry := time.Now().Add(c.ttl)
+	pipe := c.rdb.Pipeline()
+	for productID, pricing := range pricings {
+		data, err := json.Marshal(cachedPricing{
+			Pricing: *pricing,
+			Delta:   delta.Milliseconds(),
+			Expiry:  expiry.UnixMilli(),
+		})
+		if err != nil {
+			continue
+		}
+		pipe.Set(ctx, pricingCacheKey(productID), data, c.ttl)
+		pipe.Set(ctx, pricingLastKey(productID), data, lastKnownTTL)
+	}
+	pipe.Exec(ctx)
+}
+
+// load reads the entries of the given products from the keys built by key.
+// Products without an entry are left out.
+func (c *CachedPricingClient) load(ctx context.Context, productIDs []int, key func(int) string) (map[int]*cachedPricing, error) {
+	keys := make([]string, len(productIDs))
+	for i, productID := range productIDs {
+		keys[i] = key(productID)
+	}
+	values, err := c.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[int]*cachedPricing, len(values))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		entry := &cachedPricing{}
+		if err := json.Unmarshal([]byte(data), entry); err != nil {
+			continue
+		}
+		entries[productIDs[i]] = entry
+	}
+	return entries, nil
+}
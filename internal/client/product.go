@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"order-service/internal/entity"
+	"sync"
+)
+
+type ProductClient interface {
+	GetStock(ctx context.Context, productID int) (int, error)
+	// GetStocks returns the stock of every product, keyed by product ID.
+	// Products the product service does not know are left out.
+	GetStocks(ctx context.Context, productIDs []int) (map[int]int, error)
+}
+
+type HTTPProductClient struct {
+	http  *httpClient
+	batch batchSupport
+}
+
+func NewProductClient(baseURL string, opts Options) *HTTPProductClient {
+	return &HTTPProductClient{
+		http: newHTTPClient("product-service", baseURL, opts),
+	}
+}
+
+func (c *HTTPProductClient) GetStock(ctx context.Context, productID int) (int, error) {
+	var stockData map[string]int
+	err := c.http.do(ctx, http.MethodGet, fmt.Sprintf("/product/%d/stock", productID), nil, &stockData, true)
+	if err != nil {
+		return 0, err
+	}
+	return stockData["stock"], nil
+}
+
+type productStock struct {
+	ProductID int `json:"product_id"`
+	Stock     int `json:"stock"`
+}
+
+// GetStocks uses POST /product/stock/batch and falls back to one call per
+// product when the product service does not have that endpoint.
+func (c *HTTPProductClient) GetStocks(ctx context.Context, productIDs []int) (map[int]int, error) {
+	productIDs = uniqueIDs(productIDs)
+	if c.batch.supported() {
+		var stocks []productStock
+		body := map[string][]int{"product_ids": productIDs}
+		err := c.http.do(ctx, http.MethodPost, "/product/stock/batch", body, &stocks, true)
+		if err == nil {
+			result := make(map[int]int, len(stocks))
+			for _, stock := range stocks {
+				result[stock.ProductID] = stock.Stock
+			}
+			return result, nil
+		}
+		if !c.batch.check(err) {
+			return nil, err
+		}
+	}
+
+	var mu sync.Mutex
+	result := make(map[int]int, len(productIDs))
+	err := forEachBounded(ctx, productIDs, func(ctx context.Context, productID int) error {
+		stock, err := c.GetStock(ctx, productID)
+		if errors.Is(err, entity.ErrProductNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		result[productID] = stock
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
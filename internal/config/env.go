@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Env reads an environment variable, returning def when it is not set.
+func Env(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// Duration reads a time.ParseDuration value such as "15m" from the
+// environment, returning def when the variable is not set.
+func Duration(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
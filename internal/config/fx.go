@@ -0,0 +1,17 @@
+package config
+
+import (
+	"order-service/internal/entity"
+	"order-service/internal/fx"
+	"os"
+	"time"
+)
+
+// NewFXProvider reads rates from the file named by FX_RATES_FILE. Without
+// it only the base currency is accepted.
+func NewFXProvider() (fx.Provider, error) {
+	if path := os.Getenv("FX_RATES_FILE"); path != "" {
+		return fx.LoadStaticProvider(path)
+	}
+	return fx.NewStaticProvider(entity.DefaultCurrency, time.Time{}, nil)
+}
@@ -26,3 +26,12 @@ func NewKafkaWrite(topic string) *kafka.Writer {
 		AllowAutoTopicCreation: true,
 	}
 }
+
+// NewKafkaReader returns a reader that consumes topic as part of groupID.
+func NewKafkaReader(topic, groupID string) *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers: getKafkaBrokerURLs(),
+		Topic:   topic,
+		GroupID: groupID,
+	})
+}
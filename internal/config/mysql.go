@@ -0,0 +1,35 @@
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func connectDBEnv(host, port, user, pass, dbname string) (*sql.DB, error) {
+	dsn := user + ":" + pass + "@tcp(" + host + ":" + port + ")/" + dbname + "?parseTime=true"
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// NewMySQLShards opens one connection pool per shard, reading DB<n>_HOST,
+// DB<n>_PORT, DB<n>_USER, DB<n>_PASS and DB<n>_DBNAME for n = 1..count.
+func NewMySQLShards(count int) ([]*sql.DB, error) {
+	shards := make([]*sql.DB, 0, count)
+	for n := 1; n <= count; n++ {
+		env := func(name string) string {
+			return os.Getenv(fmt.Sprintf("DB%d_%s", n, name))
+		}
+		db, err := connectDBEnv(env("HOST"), env("PORT"), env("USER"), env("PASS"), env("DBNAME"))
+		if err != nil {
+			return nil, fmt.Errorf("connect shard %d: %w", n, err)
+		}
+		shards = append(shards, db)
+	}
+	return shards, nil
+}
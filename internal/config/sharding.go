@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"order-service/internal/sharding"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ShardCount reads SHARD_COUNT, defaulting to the original three shards.
+func ShardCount() (int, error) {
+	count := os.Getenv("SHARD_COUNT")
+	if count == "" {
+		return 3, nil
+	}
+	return positiveCount("SHARD_COUNT", count)
+}
+
+// ShardDBCount reads SHARD_DB_COUNT, the number of shard databases to
+// connect to. It can exceed ShardCount while data is being moved to new
+// shards and defaults to ShardCount.
+func ShardDBCount() (int, error) {
+	count := os.Getenv("SHARD_DB_COUNT")
+	if count == "" {
+		return ShardCount()
+	}
+	return positiveCount("SHARD_DB_COUNT", count)
+}
+
+func positiveCount(name, value string) (int, error) {
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if count < 1 {
+		return 0, fmt.Errorf("%s must be at least 1, got %d", name, count)
+	}
+	return count, nil
+}
+
+// NewShardStrategy builds the strategy named by SHARD_STRATEGY ("modulo",
+// the default, or "consistent"). The consistent hash ring reads per-shard
+// weights from SHARD_WEIGHTS ("1,1,2") and virtual nodes per unit of weight
+// from SHARD_VNODES.
+func NewShardStrategy(shardCount int) (sharding.Strategy, error) {
+	switch name := os.Getenv("SHARD_STRATEGY"); name {
+	case "", "modulo":
+		return sharding.NewModuloStrategy(shardCount), nil
+	case "consistent":
+		weights, err := shardWeights(shardCount)
+		if err != nil {
+			return nil, err
+		}
+		vnodes := 160
+		if v := os.Getenv("SHARD_VNODES"); v != "" {
+			if vnodes, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("invalid SHARD_VNODES: %w", err)
+			}
+		}
+		return sharding.NewConsistentHashStrategy(weights, vnodes)
+	default:
+		return nil, fmt.Errorf("unknown SHARD_STRATEGY %q", name)
+	}
+}
+
+func shardWeights(shardCount int) ([]int, error) {
+	weights := make([]int, shardCount)
+	raw := os.Getenv("SHARD_WEIGHTS")
+	if raw == "" {
+		for i := range weights {
+			weights[i] = 1
+		}
+		return weights, nil
+	}
+	parts := strings.Split(raw, ",")
+	if len(parts) != shardCount {
+		return nil, fmt.Errorf("SHARD_WEIGHTS has %d entries, want %d", len(parts), shardCount)
+	}
+	for i, part := range parts {
+		weight, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SHARD_WEIGHTS entry %q: %w", part, err)
+		}
+		weights[i] = weight
+	}
+	return weights, nil
+}
@@ -0,0 +1,16 @@
+package config
+
+import (
+	"order-service/internal/tax"
+	"os"
+)
+
+// NewTaxCalculator reads the tax rules from the file named by
+// TAX_RULES_FILE. Without it every order is taxed at zero, as before tax
+// was calculated here.
+func NewTaxCalculator() (tax.Calculator, error) {
+	if path := os.Getenv("TAX_RULES_FILE"); path != "" {
+		return tax.LoadRulesCalculator(path)
+	}
+	return tax.NewRulesCalculator([]tax.Rule{{Region: tax.Any, Category: tax.Any, Rate: "0"}})
+}
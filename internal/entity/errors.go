@@ -0,0 +1,68 @@
+package entity
+
+import "errors"
+
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidStatus = errors.New("invalid order status")
+	// ErrStatusChanged means the order status moved, or the order otherwise
+	// changed, between reading the order and writing the transition.
+	ErrStatusChanged = errors.New("order status changed concurrently")
+	// ErrVersionMismatch means the order changed since the version the
+	// update was made against.
+	ErrVersionMismatch = errors.New("order version mismatch")
+	ErrVersionRequired = errors.New("order version required, send If-Match or version")
+	ErrOutOfStock      = errors.New("product out of stock")
+	ErrInvalidQuantity = errors.New("quantity must be positive")
+	// ErrReservationNotActive means the order holds no stock, because its
+	// reservation was never made, already converted, released or expired.
+	ErrReservationNotActive = errors.New("stock reservation not active")
+	ErrUpstreamUnavailable  = errors.New("upstream service unavailable")
+	// ErrShardMoving means the order's slot is being moved to another shard
+	// and takes no writes until the move is done.
+	ErrShardMoving     = errors.New("order shard is moving, retry shortly")
+	ErrProductNotFound = errors.New("product not found")
+	// ErrInvalidQuote means the quote does not exist, was tampered with, or
+	// does not cover the order.
+	ErrInvalidQuote = errors.New("invalid quote")
+	ErrQuoteExpired = errors.New("quote expired")
+	// ErrUnsupportedCurrency means there is no exchange rate for the
+	// currency.
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrCouponNotFound      = errors.New("coupon not found")
+	// ErrCouponNotApplicable means the coupon is outside its time window or
+	// the order does not meet its conditions.
+	ErrCouponNotApplicable = errors.New("coupon not applicable")
+	ErrCouponLimitReached  = errors.New("coupon usage limit reached")
+	ErrInvalidPromotion    = errors.New("invalid promotion")
+	// ErrNoTaxRule means no tax rule covers a line's region and category.
+	ErrNoTaxRule = errors.New("no tax rule")
+	// ErrRegionChangeNotAllowed means the order is past the point where its
+	// shipping region, and with it its tax, may change.
+	ErrRegionChangeNotAllowed = errors.New("shipping region change not allowed")
+	// ErrTotalsMismatch means the client sent order totals that differ from
+	// the ones computed from the lines.
+	ErrTotalsMismatch = errors.New("order totals mismatch")
+	ErrLineNotFound   = errors.New("order line not found")
+	// ErrAmountOverflow means an amount does not fit in int64 minor units.
+	ErrAmountOverflow = errors.New("amount out of range")
+	// ErrCurrencyMismatch means amounts in different currencies were added
+	// or subtracted without converting them first.
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	// ErrLineChangeNotAllowed means the order is past the point where its
+	// lines may be cancelled or reduced.
+	ErrLineChangeNotAllowed = errors.New("order line change not allowed")
+	// ErrPaymentStatus means a client tried to set a status that only
+	// payment events may set.
+	ErrPaymentStatus       = errors.New("status is set by payment events")
+	ErrInvalidPaymentEvent = errors.New("invalid payment event")
+	ErrSagaNotFound        = errors.New("checkout saga not found")
+	// ErrSagaChanged means another instance saved the saga since it was
+	// read, so it is the one carrying it on.
+	ErrSagaChanged    = errors.New("checkout saga changed concurrently")
+	ErrReturnNotFound = errors.New("return request not found")
+	// ErrReturnNotAllowed means the order or line cannot be returned, or
+	// the return is not in the state the action needs.
+	ErrReturnNotAllowed = errors.New("return not allowed")
+)
@@ -0,0 +1,47 @@
+package entity
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// FXRate is the exchange rate an order was priced with: one unit of From
+// buys Rate units of To. Rate is a decimal string so the stored rate can be
+// applied again and give the same amounts.
+type FXRate struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	Rate string    `json:"rate"`
+	AsOf time.Time `json:"as_of"`
+}
+
+// IdentityRate converts currency into itself.
+func IdentityRate(currency string) FXRate {
+	return FXRate{From: currency, To: currency, Rate: "1"}
+}
+
+// Convert turns an amount in r.From into r.To, rounding to the minor unit
+// of r.To with mode.
+func (r FXRate) Convert(m Money, mode RoundingMode) (Money, error) {
+	if m.Currency != r.From && m.Currency != "" {
+		return Money{}, fmt.Errorf("%w: cannot convert %s with a %s rate", ErrUnsupportedCurrency, m.Currency, r.From)
+	}
+	rate, ok := new(big.Rat).SetString(r.Rate)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid rate %q", r.Rate)
+	}
+	v := new(big.Rat).SetFrac(big.NewInt(m.Amount), big.NewInt(pow10(currencyExponent(r.From))))
+	v.Mul(v, rate)
+	v.Mul(v, new(big.Rat).SetInt64(pow10(currencyExponent(r.To))))
+	return Money{Amount: roundRat(v, mode).Int64(), Currency: r.To}, nil
+}
+
+// Inverse returns the rate converting r.To back into r.From.
+func (r FXRate) Inverse() (FXRate, error) {
+	rate, ok := new(big.Rat).SetString(r.Rate)
+	if !ok || rate.Sign() == 0 {
+		return FXRate{}, fmt.Errorf("invalid rate %q", r.Rate)
+	}
+	return FXRate{From: r.To, To: r.From, Rate: new(big.Rat).Inv(rate).FloatString(12), AsOf: r.AsOf}, nil
+}
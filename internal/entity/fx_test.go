@@ -0,0 +1,99 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFXRateConvert(t *testing.T) {
+	tests := []struct {
+		rate FXRate
+		m    Money
+		mode RoundingMode
+		want Money
+	}{
+		{IdentityRate("USD"), NewMoney(1234, "USD"), RoundHalfEven, NewMoney(1234, "USD")},
+		{FXRate{From: "IDR", To: "USD", Rate: "0.0000625"}, NewMoney(1600000, "IDR"), RoundHalfEven, NewMoney(100, "USD")},
+		{FXRate{From: "USD", To: "IDR", Rate: "16000"}, NewMoney(1, "USD"), RoundHalfEven, NewMoney(16000, "IDR")},
+		// 0.01 USD is 1.505 JPY; 1.00 USD is 150.5 JPY
+		{FXRate{From: "USD", To: "JPY", Rate: "150.5"}, NewMoney(1, "USD"), RoundHalfEven, NewMoney(2, "JPY")},
+		{FXRate{From: "USD", To: "JPY", Rate: "150.5"}, NewMoney(100, "USD"), RoundHalfEven, NewMoney(150, "JPY")},
+		{FXRate{From: "USD", To: "JPY", Rate: "150.5"}, NewMoney(100, "USD"), RoundHalfUp, NewMoney(151, "JPY")},
+		{FXRate{From: "USD", To: "JPY", Rate: "150.5"}, NewMoney(100, "USD"), RoundDown, NewMoney(150, "JPY")},
+		{FXRate{From: "USD", To: "JPY", Rate: "150.5"}, NewMoney(-100, "USD"), RoundHalfUp, NewMoney(-151, "JPY")},
+		{FXRate{From: "JPY", To: "USD", Rate: "0.0066"}, NewMoney(150, "JPY"), RoundHalfEven, NewMoney(99, "USD")},
+		// an amount without a currency is taken to be in From
+		{FXRate{From: "USD", To: "IDR", Rate: "16000"}, Money{Amount: 2}, RoundHalfEven, NewMoney(32000, "IDR")},
+	}
+	for _, tt := range tests {
+		got, err := tt.rate.Convert(tt.m, tt.mode)
+		if err != nil {
+			t.Errorf("Convert(%+v) with %+v: %v", tt.m, tt.rate, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Convert(%+v) with %+v mode %d = %+v, want %+v", tt.m, tt.rate, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestFXRateConvertRejects(t *testing.T) {
+	rate := FXRate{From: "USD", To: "IDR", Rate: "16000"}
+	if _, err := rate.Convert(NewMoney(100, "SGD"), RoundHalfEven); !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Errorf("Convert of SGD with a USD rate = %v, want %v", err, ErrUnsupportedCurrency)
+	}
+	rate.Rate = "abc"
+	if _, err := rate.Convert(NewMoney(100, "USD"), RoundHalfEven); err == nil {
+		t.Error("Convert with an invalid rate succeeded")
+	}
+}
+
+func TestFXRateInverse(t *testing.T) {
+	tests := []struct {
+		rate string
+		want string
+	}{
+		{"16000", "0.000062500000"},
+		{"1", "1.000000000000"},
+		{"3", "0.333333333333"},
+		{"1.5", "0.666666666667"},
+	}
+	for _, tt := range tests {
+		rate := FXRate{From: "USD", To: "IDR", Rate: tt.rate}
+		inverse, err := rate.Inverse()
+		if err != nil {
+			t.Errorf("Inverse of %s: %v", tt.rate, err)
+			continue
+		}
+		if want := (FXRate{From: "IDR", To: "USD", Rate: tt.want}); inverse != want {
+			t.Errorf("Inverse of %s = %+v, want %+v", tt.rate, inverse, want)
+		}
+	}
+
+	for _, rate := range []string{"0", "abc", ""} {
+		if _, err := (FXRate{From: "USD", To: "IDR", Rate: rate}).Inverse(); err == nil {
+			t.Errorf("Inverse of %q succeeded", rate)
+		}
+	}
+}
+
+func TestFXRateInverseConvertsBack(t *testing.T) {
+	rate := FXRate{From: "USD", To: "IDR", Rate: "16000"}
+	inverse, err := rate.Inverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, amount := range []int64{1, 99, 100, 123456} {
+		converted, err := rate.Convert(NewMoney(amount, "USD"), RoundHalfEven)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := inverse.Convert(converted, RoundHalfEven)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back != NewMoney(amount, "USD") {
+			t.Errorf("%d USD converts back to %+v", amount, back)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// LineChange records a line of an order being cancelled or its quantity
+// reduced. Index is the position the line had in ProductRequests; a
+// cancelled line is removed, so the lines after it move up by one.
+type LineChange struct {
+	OrderID      int64     `json:"order_id,string"`
+	Index        int       `json:"index"`
+	ProductID    int       `json:"product_id"`
+	FromQuantity int       `json:"from_quantity"`
+	ToQuantity   int       `json:"to_quantity"`
+	Actor        string    `json:"actor"`
+	Reason       string    `json:"reason"`
+	CreatedAt    time.Time `json:"created_at"`
+}
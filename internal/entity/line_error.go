@@ -0,0 +1,54 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LineError is why one line of an order was rejected. Index is the
+// position of the line in ProductRequests.
+type LineError struct {
+	Index     int    `json:"index"`
+	ProductID int    `json:"product_id"`
+	Err       error  `json:"-"`
+	Reason    string `json:"error"`
+}
+
+func NewLineError(index, productID int, err error) LineError {
+	return LineError{Index: index, ProductID: productID, Err: err, Reason: err.Error()}
+}
+
+// OrderLinesError reports every rejected line of an order at once, so the
+// client can fix them all in one go. errors.Is matches the error of any
+// line.
+type OrderLinesError struct {
+	Lines []LineError `json:"lines"`
+}
+
+func (e *OrderLinesError) Error() string {
+	parts := make([]string, len(e.Lines))
+	for i, line := range e.Lines {
+		parts[i] = fmt.Sprintf("line %d (product %d): %v", line.Index, line.ProductID, line.Err)
+	}
+	return "order lines rejected: " + strings.Join(parts, "; ")
+}
+
+func (e *OrderLinesError) Unwrap() []error {
+	errs := make([]error, len(e.Lines))
+	for i, line := range e.Lines {
+		errs[i] = line.Err
+	}
+	return errs
+}
+
+// OnlyOutOfStock reports whether every line was rejected for lack of
+// stock, which is a conflict with other buyers rather than a bad request.
+func (e *OrderLinesError) OnlyOutOfStock() bool {
+	for _, line := range e.Lines {
+		if !errors.Is(line.Err, ErrOutOfStock) {
+			return false
+		}
+	}
+	return len(e.Lines) > 0
+}
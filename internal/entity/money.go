@@ -0,0 +1,288 @@
+package entity
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DefaultCurrency is the currency of amounts that do not carry one, such as
+// the plain numbers returned by the pricing service.
+const DefaultCurrency = "IDR"
+
+// currencyExponents is the number of minor unit digits per ISO 4217 code.
+// Currencies that are not listed have two.
+var currencyExponents = map[string]int{
+	"IDR": 2,
+	"USD": 2,
+	"EUR": 2,
+	"SGD": 2,
+	"MYR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+}
+
+func currencyExponent(currency string) int {
+	if exp, ok := currencyExponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+// RoundingMode says how a value between two minor units is rounded.
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds ties to the even minor unit (banker's rounding).
+	// It is the mode used for every amount the service computes.
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds ties away from zero.
+	RoundHalfUp
+	// RoundDown truncates towards zero.
+	RoundDown
+)
+
+// Money is an amount in integer minor units of a currency, so sums and
+// products are exact. The zero value is zero in no particular currency and
+// takes the currency of the first amount added to it.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney reads a decimal string such as "1999.995" and rounds it to
+// the minor unit of currency with mode.
+func ParseMoney(s, currency string, mode RoundingMode) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(currencyExponent(currency))), nil)
+	r.Mul(r, new(big.Rat).SetInt(scale))
+	amount := roundRat(r, mode)
+	if !amount.IsInt64() {
+		return Money{}, fmt.Errorf("amount %q out of range", s)
+	}
+	return Money{Amount: amount.Int64(), Currency: currency}, nil
+}
+
+// roundRat rounds r to an integer with mode.
+func roundRat(r *big.Rat, mode RoundingMode) *big.Int {
+	quo, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Sign() == 0 || mode == RoundDown {
+		return quo
+	}
+	// compare twice the remainder with the denominator to find ties
+	cmp := new(big.Int).Abs(new(big.Int).Mul(rem, big.NewInt(2))).Cmp(r.Denom())
+	away := cmp > 0 || (cmp == 0 && (mode == RoundHalfUp || quo.Bit(0) == 1))
+	if away {
+		if r.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return quo
+}
+
+// compatible reports whether m and other can be combined. The zero value
+// is compatible with every currency.
+func (m Money) compatible(other Money) bool {
+	return m.Currency == other.Currency || m.Currency == "" || other.Currency == ""
+}
+
+func (m Money) currencyWith(other Money) string {
+	if m.Currency != "" {
+		return m.Currency
+	}
+	return other.Currency
+}
+
+// Add returns m + other. Amounts in different currencies cannot be added,
+// they are converted first; a mismatch returns ErrCurrencyMismatch, and a
+// sum that does not fit in an int64 ErrAmountOverflow.
+func (m Money) Add(other Money) (Money, error) {
+	if !m.compatible(other) {
+		return Money{}, fmt.Errorf("%w: add %s to %s", ErrCurrencyMismatch, other.Currency, m.Currency)
+	}
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, fmt.Errorf("%w: %s %s plus %s", ErrAmountOverflow, m, m.Currency, other)
+	}
+	return Money{Amount: sum, Currency: m.currencyWith(other)}, nil
+}
+
+// Sub returns m - other, with the same rules as Add.
+func (m Money) Sub(other Money) (Money, error) {
+	if !m.compatible(other) {
+		return Money{}, fmt.Errorf("%w: subtract %s from %s", ErrCurrencyMismatch, other.Currency, m.Currency)
+	}
+	diff := m.Amount - other.Amount
+	if (other.Amount > 0 && diff > m.Amount) || (other.Amount < 0 && diff < m.Amount) {
+		return Money{}, fmt.Errorf("%w: %s %s minus %s", ErrAmountOverflow, m, m.Currency, other)
+	}
+	return Money{Amount: diff, Currency: m.currencyWith(other)}, nil
+}
+
+// Mul returns m times a whole quantity, which is exact. It returns
+// ErrAmountOverflow when the product does not fit in an int64.
+func (m Money) Mul(quantity int64) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(quantity))
+	if !product.IsInt64() {
+		return Money{}, fmt.Errorf("%w: %s %s times %d", ErrAmountOverflow, m, m.Currency, quantity)
+	}
+	return Money{Amount: product.Int64(), Currency: m.Currency}, nil
+}
+
+// MulRat returns m times num/den, rounded to the minor unit with mode. It
+// returns ErrAmountOverflow when the result does not fit in an int64.
+func (m Money) MulRat(num, den int64, mode RoundingMode) (Money, error) {
+	return m.MulBigRat(big.NewRat(num, den), mode)
+}
+
+// MulBigRat returns m times factor, rounded to the minor unit with mode,
+// for factors whose numerator or denominator does not fit in an int64. It
+// returns ErrAmountOverflow when the result does not.
+func (m Money) MulBigRat(factor *big.Rat, mode RoundingMode) (Money, error) {
+	r := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), factor)
+	amount := roundRat(r, mode)
+	if !amount.IsInt64() {
+		return Money{}, fmt.Errorf("%w: %s %s times %s", ErrAmountOverflow, m, m.Currency, factor.RatString())
+	}
+	return Money{Amount: amount.Int64(), Currency: m.Currency}, nil
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Equal reports whether m and other are the same amount. Zero amounts are
+// equal whatever their currency.
+func (m Money) Equal(other Money) bool {
+	if m.Amount == 0 && other.Amount == 0 {
+		return true
+	}
+	return m.Amount == other.Amount && m.Currency == other.Currency
+}
+
+// String formats the amount as a decimal without the currency, for
+// example "1999.50".
+func (m Money) String() string {
+	exp := currencyExponent(m.Currency)
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if exp == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+	s := fmt.Sprintf("%0*d", exp+1, amount)
+	return sign + s[:len(s)-exp] + "." + s[len(s)-exp:]
+}
+
+// moneyJSON is the JSON form of Money. The amount is a decimal string so
+// clients do not parse it into a float.
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return json.Marshal(moneyJSON{Amount: Money{Amount: m.Amount, Currency: currency}.String(), Currency: currency})
+}
+
+// UnmarshalJSON accepts the object written by MarshalJSON, and a plain
+// number or decimal string in DefaultCurrency as sent by older clients and
+// the pricing service. Extra digits are rounded half-even.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '{' {
+		var v moneyJSON
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		if v.Currency == "" {
+			v.Currency = DefaultCurrency
+		}
+		parsed, err := ParseMoney(v.Amount, v.Currency, RoundHalfEven)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("invalid amount %s", data)
+	}
+	parsed, err := ParseMoney(number.String(), DefaultCurrency, RoundHalfEven)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads a DECIMAL column. The column carries no currency, so the
+// amount is in DefaultCurrency until the caller sets the order's currency.
+func (m *Money) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*m = Money{Currency: DefaultCurrency}
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		*m = Money{Amount: v * pow10(currencyExponent(DefaultCurrency)), Currency: DefaultCurrency}
+		return nil
+	case float64:
+		// only reached when the column is not DECIMAL
+		s = big.NewFloat(v).Text('f', -1)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	parsed, err := ParseMoney(s, DefaultCurrency, RoundHalfEven)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value writes the amount as a decimal string for a DECIMAL column.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,293 @@
+package entity
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		mode     RoundingMode
+		want     int64
+	}{
+		{"1999.50", "IDR", RoundHalfEven, 199950},
+		{" 12 ", "USD", RoundHalfEven, 1200},
+		{"0.005", "USD", RoundHalfEven, 0},
+		{"0.015", "USD", RoundHalfEven, 2},
+		{"0.025", "USD", RoundHalfEven, 2},
+		{"0.025", "USD", RoundHalfUp, 3},
+		{"0.029", "USD", RoundDown, 2},
+		{"0.0251", "USD", RoundHalfEven, 3},
+		{"-0.025", "USD", RoundHalfEven, -2},
+		{"-0.025", "USD", RoundHalfUp, -3},
+		{"-0.029", "USD", RoundDown, -2},
+		{"1999.995", "IDR", RoundHalfEven, 200000},
+		{"150.5", "JPY", RoundHalfEven, 150},
+		{"151.5", "JPY", RoundHalfEven, 152},
+		{"150.5", "JPY", RoundHalfUp, 151},
+		{"7", "XYZ", RoundHalfEven, 700},
+		{"1/3", "USD", RoundHalfEven, 33},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in, tt.currency, tt.mode)
+		if err != nil {
+			t.Errorf("ParseMoney(%q, %s, %d): %v", tt.in, tt.currency, tt.mode, err)
+			continue
+		}
+		if got != NewMoney(tt.want, tt.currency) {
+			t.Errorf("ParseMoney(%q, %s, %d) = %d %s, want %d", tt.in, tt.currency, tt.mode, got.Amount, got.Currency, tt.want)
+		}
+	}
+}
+
+func TestParseMoneyRejects(t *testing.T) {
+	for _, in := range []string{"", "abc", "1.2.3", "1e30"} {
+		if got, err := ParseMoney(in, "USD", RoundHalfEven); err == nil {
+			t.Errorf("ParseMoney(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestMoneyMulRat(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		num, den int64
+		mode     RoundingMode
+		want     int64
+	}{
+		{1000, 1, 3, RoundHalfEven, 333},
+		{1000, 2, 3, RoundHalfEven, 667},
+		{5, 1, 2, RoundHalfEven, 2},
+		{7, 1, 2, RoundHalfEven, 4},
+		{5, 1, 2, RoundHalfUp, 3},
+		{5, 1, 2, RoundDown, 2},
+		{999, 1, 2, RoundDown, 499},
+		{-5, 1, 2, RoundHalfEven, -2},
+		{-5, 1, 2, RoundHalfUp, -3},
+		{-7, 1, 2, RoundDown, -3},
+		{1000, 11, 100, RoundHalfEven, 110},
+		{0, 1, 3, RoundHalfEven, 0},
+	}
+	for _, tt := range tests {
+		got, err := NewMoney(tt.amount, "USD").MulRat(tt.num, tt.den, tt.mode)
+		if err != nil {
+			t.Errorf("%d * %d/%d: %v", tt.amount, tt.num, tt.den, err)
+			continue
+		}
+		if got != NewMoney(tt.want, "USD") {
+			t.Errorf("%d * %d/%d mode %d = %d, want %d", tt.amount, tt.num, tt.den, tt.mode, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestMoneyMulBigRat(t *testing.T) {
+	// an inclusive 11% tax is price * 0.11 / 1.11
+	rate := big.NewRat(11, 100)
+	factor := new(big.Rat).Quo(rate, new(big.Rat).Add(big.NewRat(1, 1), rate))
+	got, err := NewMoney(111000, "IDR").MulBigRat(factor, RoundHalfEven)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != NewMoney(11000, "IDR") {
+		t.Fatalf("tax = %d, want 11000", got.Amount)
+	}
+}
+
+func TestMoneyMulOverflow(t *testing.T) {
+	if _, err := NewMoney(math.MaxInt64/2+1, "USD").Mul(2); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("Mul = %v, want %v", err, ErrAmountOverflow)
+	}
+	if _, err := NewMoney(math.MaxInt64, "USD").MulRat(3, 2, RoundHalfEven); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("MulRat = %v, want %v", err, ErrAmountOverflow)
+	}
+	got, err := NewMoney(1250, "USD").Mul(3)
+	if err != nil || got != NewMoney(3750, "USD") {
+		t.Errorf("Mul = %v, %v, want 3750", got, err)
+	}
+}
+
+func TestMoneyAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Money
+		want Money
+		err  error
+	}{
+		{"same currency", NewMoney(150, "USD"), NewMoney(50, "USD"), NewMoney(200, "USD"), nil},
+		{"zero value takes the currency", Money{}, NewMoney(50, "USD"), NewMoney(50, "USD"), nil},
+		{"to the zero value", NewMoney(50, "USD"), Money{}, NewMoney(50, "USD"), nil},
+		{"currency mismatch", NewMoney(150, "USD"), NewMoney(50, "IDR"), Money{}, ErrCurrencyMismatch},
+		{"overflow", NewMoney(math.MaxInt64, "USD"), NewMoney(1, "USD"), Money{}, ErrAmountOverflow},
+		{"underflow", NewMoney(math.MinInt64, "USD"), NewMoney(-1, "USD"), Money{}, ErrAmountOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Add(tt.b)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Fatalf("Add = %+v, %v, want %+v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestMoneySub(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Money
+		want Money
+		err  error
+	}{
+		{"same currency", NewMoney(150, "USD"), NewMoney(50, "USD"), NewMoney(100, "USD"), nil},
+		{"below zero", NewMoney(50, "USD"), NewMoney(150, "USD"), NewMoney(-100, "USD"), nil},
+		{"from the zero value", Money{}, NewMoney(50, "USD"), NewMoney(-50, "USD"), nil},
+		{"currency mismatch", NewMoney(150, "USD"), NewMoney(50, "IDR"), Money{}, ErrCurrencyMismatch},
+		{"overflow", NewMoney(math.MaxInt64, "USD"), NewMoney(-1, "USD"), Money{}, ErrAmountOverflow},
+		{"underflow", NewMoney(math.MinInt64, "USD"), NewMoney(1, "USD"), Money{}, ErrAmountOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Sub(tt.b)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Fatalf("Sub = %+v, %v, want %+v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{NewMoney(199950, "IDR"), "1999.50"},
+		{NewMoney(5, "USD"), "0.05"},
+		{NewMoney(-5, "USD"), "-0.05"},
+		{NewMoney(0, "USD"), "0.00"},
+		{NewMoney(1500, "JPY"), "1500"},
+		{NewMoney(-1500, "JPY"), "-1500"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("String(%d %s) = %q, want %q", tt.m.Amount, tt.m.Currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyEqual(t *testing.T) {
+	tests := []struct {
+		a, b Money
+		want bool
+	}{
+		{NewMoney(100, "USD"), NewMoney(100, "USD"), true},
+		{NewMoney(100, "USD"), NewMoney(100, "IDR"), false},
+		{NewMoney(100, "USD"), NewMoney(101, "USD"), false},
+		{NewMoney(0, "USD"), Money{}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Equal(tt.b); got != tt.want {
+			t.Errorf("%+v.Equal(%+v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{NewMoney(199950, "IDR"), `{"amount":"1999.50","currency":"IDR"}`},
+		{NewMoney(-5, "USD"), `{"amount":"-0.05","currency":"USD"}`},
+		{NewMoney(1500, "JPY"), `{"amount":"1500","currency":"JPY"}`},
+		{Money{Amount: 100}, `{"amount":"1.00","currency":"IDR"}`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("Marshal(%+v) = %s, want %s", tt.m, data, tt.want)
+		}
+		var back Money
+		if err := json.Unmarshal(data, &back); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", data, err)
+		}
+		want := tt.m
+		if want.Currency == "" {
+			want.Currency = DefaultCurrency
+		}
+		if back != want {
+			t.Errorf("round trip of %s = %+v, want %+v", data, back, want)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{`1999.5`, NewMoney(199950, "IDR")},
+		{`"1999.5"`, NewMoney(199950, "IDR")},
+		{`12.345`, NewMoney(1234, "IDR")},
+		{`12.355`, NewMoney(1236, "IDR")},
+		{`{"amount":"2.5","currency":"USD"}`, NewMoney(250, "USD")},
+		{`{"amount":"2.5"}`, NewMoney(250, "IDR")},
+		{`{"amount":"2.5","currency":"JPY"}`, NewMoney(2, "JPY")},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{`"abc"`, `true`, `{"amount":"x"}`} {
+		var got Money
+		if err := json.Unmarshal([]byte(in), &got); err == nil {
+			t.Errorf("Unmarshal(%s) = %+v, want an error", in, got)
+		}
+	}
+
+	got := NewMoney(5, "USD")
+	if err := json.Unmarshal([]byte(`null`), &got); err != nil || got != NewMoney(5, "USD") {
+		t.Errorf("Unmarshal(null) = %+v, %v, want the value left alone", got, err)
+	}
+}
+
+func TestMoneyScanValue(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Money
+	}{
+		{[]byte("1999.5000"), NewMoney(199950, "IDR")},
+		{"0.0050", NewMoney(0, "IDR")},
+		{"0.0150", NewMoney(2, "IDR")},
+		{int64(12), NewMoney(1200, "IDR")},
+		{nil, NewMoney(0, "IDR")},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := got.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%v): %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Scan(%v) = %+v, want %+v", tt.src, got, tt.want)
+		}
+	}
+
+	value, err := NewMoney(199950, "IDR").Value()
+	if err != nil || value != "1999.50" {
+		t.Errorf("Value = %v, %v, want 1999.50", value, err)
+	}
+}
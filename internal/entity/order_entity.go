@@ -1,23 +1,57 @@
 // ini entoty
 package entity
 
+import "time"
+
 type OrderEntity struct {
 	ID              int              `json:"id"`
 	UserID          int              `json:"user_id"`
-	OrderID         int              `json:"order_id"`
+	OrderID         int64            `json:"order_id,string"`
 	ProductRequests []ProductRequest `json:"product_requests"`
 	Quantity        int              `json:"quantity"`
-	Total           float64          `json:"total"`
-	TotalMarkUp     float64          `json:"total_mark_up"`
-	TotalDiscount   float64          `json:"total_discount"`
-	Status          string           `json:"status"`
+	Total           Money            `json:"total"`
+	TotalMarkUp     Money            `json:"total_mark_up"`
+	TotalDiscount   Money            `json:"total_discount"`
+	Status          OrderStatus      `json:"status"`
 	IdempotentKey   string           `json:"idempotent_key"`
+	CreatedAt       time.Time        `json:"created_at"`
+	// Currency is what the buyer is charged in. The amounts of the order and
+	// its lines are in Currency; BaseTotal is Total in the base currency,
+	// converted with FXRate when the order was created.
+	Currency  string `json:"currency"`
+	BaseTotal Money  `json:"base_total"`
+	FXRate    FXRate `json:"fx_rate"`
+	// ShippingRegion picks the tax rules of the order. TotalTax is the tax of
+	// all lines; exclusive tax is part of Total, inclusive tax already is.
+	ShippingRegion string `json:"shipping_region"`
+	TotalTax       Money  `json:"total_tax"`
+	// CouponCodes are the promotions applied to the order.
+	CouponCodes []string `json:"coupon_codes,omitempty"`
+	// QuoteID names the quote whose locked prices the order is charged.
+	QuoteID string `json:"quote_id,omitempty"`
+	// PriceFallback is set when some line was priced with a last known
+	// price because the pricing service was down.
+	PriceFallback bool `json:"price_fallback"`
+	// Version goes up with every change to the order. Updates must name
+	// the version they were made against.
+	Version int64 `json:"version"`
 }
 
 type ProductRequest struct {
-	ProductID  int     `json:"product_id"`
-	Quantity   int     `json:"quantity"`
-	MarkUp     float64 `json:"mark_up"`
-	Discount   float64 `json:"discount"`
-	FinalPrice float64 `json:"final_price"`
+	ProductID  int   `json:"product_id"`
+	Quantity   int   `json:"quantity"`
+	MarkUp     Money `json:"mark_up"`
+	Discount   Money `json:"discount"`
+	FinalPrice Money `json:"final_price"`
+	// PromoDiscount is the discount the order's coupons gave the line, on
+	// top of Discount from pricing. It is already taken off FinalPrice, and
+	// Promotions breaks it down per coupon.
+	PromoDiscount Money           `json:"promo_discount"`
+	Promotions    []LinePromotion `json:"promotions,omitempty"`
+	// TaxCategory comes from pricing. Tax is the line's tax at TaxRate;
+	// inclusive tax is part of FinalPrice, exclusive tax is added to it.
+	TaxCategory  string `json:"tax_category,omitempty"`
+	Tax          Money  `json:"tax"`
+	TaxRate      string `json:"tax_rate,omitempty"`
+	TaxInclusive bool   `json:"tax_inclusive"`
 }
@@ -0,0 +1,21 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OrderEvent is one entry of the audit log of an order. Before and After
+// are snapshots of what Action changed: the order with its lines, or the
+// return for return actions. Before is null when the action created it and
+// After when the action deleted it. EventID identifies the entry on every
+// shard it is copied to.
+type OrderEvent struct {
+	EventID   string          `json:"event_id"`
+	OrderID   int64           `json:"order_id,string"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"created_at"`
+}
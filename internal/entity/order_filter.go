@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// OrderFilter describes a page of a user's orders. Orders are returned
+// newest first; AfterOrderID is the last order of the previous page and is
+// zero for the first page.
+type OrderFilter struct {
+	UserID       int
+	Status       OrderStatus
+	From         time.Time
+	To           time.Time
+	Limit        int
+	AfterOrderID int64
+}
+
+type OrderPage struct {
+	Orders     []*OrderEntity `json:"orders"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,91 @@
+package entity
+
+import (
+	"fmt"
+	"time"
+)
+
+type OrderStatus string
+
+const (
+	StatusPending         OrderStatus = "pending"
+	StatusAwaitingPayment OrderStatus = "awaiting_payment"
+	StatusPaid            OrderStatus = "paid"
+	StatusFulfilling      OrderStatus = "fulfilling"
+	StatusShipped         OrderStatus = "shipped"
+	StatusDelivered       OrderStatus = "delivered"
+	StatusCancelled       OrderStatus = "cancelled"
+	StatusRefunded        OrderStatus = "refunded"
+	StatusExpired         OrderStatus = "expired"
+	// StatusPartiallyRefunded is an order some of whose lines were
+	// refunded; it becomes refunded once every line is. The rest of the
+	// order carries on to be fulfilled, shipped and delivered.
+	StatusPartiallyRefunded OrderStatus = "partially_refunded"
+)
+
+// orderTransitions lists, for every status, the statuses an order may move
+// to next. Statuses without an entry are terminal.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	StatusPending:           {StatusAwaitingPayment, StatusCancelled, StatusExpired},
+	StatusAwaitingPayment:   {StatusPaid, StatusCancelled, StatusExpired},
+	StatusPaid:              {StatusFulfilling, StatusPartiallyRefunded, StatusRefunded},
+	StatusFulfilling:        {StatusShipped, StatusPartiallyRefunded, StatusRefunded},
+	StatusShipped:           {StatusDelivered},
+	StatusDelivered:         {StatusPartiallyRefunded, StatusRefunded},
+	StatusPartiallyRefunded: {StatusFulfilling, StatusShipped, StatusDelivered, StatusRefunded},
+}
+
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case StatusPending, StatusAwaitingPayment, StatusPaid, StatusFulfilling, StatusShipped,
+		StatusDelivered, StatusCancelled, StatusRefunded, StatusPartiallyRefunded, StatusExpired:
+		return true
+	}
+	return false
+}
+
+func (s OrderStatus) IsTerminal() bool {
+	return s.IsValid() && len(orderTransitions[s]) == 0
+}
+
+// IsPaymentDriven reports whether only payment events may move an order to
+// the status, never a client.
+func (s OrderStatus) IsPaymentDriven() bool {
+	return s == StatusPaid || s == StatusRefunded || s == StatusPartiallyRefunded
+}
+
+// IsReturnable reports whether lines of an order in the status may be
+// returned for a refund.
+func (s OrderStatus) IsReturnable() bool {
+	return s == StatusPartiallyRefunded || s.CanTransitionTo(StatusRefunded)
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionError is returned when an order is asked to move to a status
+// its current status does not allow.
+type TransitionError struct {
+	From OrderStatus
+	To   OrderStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot transition order from %s to %s", e.From, e.To)
+}
+
+// StatusTransition records a single status change, who made it and why.
+type StatusTransition struct {
+	OrderID   int64       `json:"order_id,string"`
+	From      OrderStatus `json:"from"`
+	To        OrderStatus `json:"to"`
+	Actor     string      `json:"actor"`
+	Reason    string      `json:"reason"`
+	CreatedAt time.Time   `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// OutboxMessage is an order event written in the same transaction as the
+// order change and published to Kafka later by the outbox relay.
+type OutboxMessage struct {
+	ID            int64
+	OrderID       int64
+	EventType     string
+	Payload       []byte
+	Attempts      int
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+}
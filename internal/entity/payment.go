@@ -0,0 +1,42 @@
+package entity
+
+import "time"
+
+type PaymentEventType string
+
+const (
+	PaymentSucceeded PaymentEventType = "payment.succeeded"
+	PaymentFailed    PaymentEventType = "payment.failed"
+	PaymentRefunded  PaymentEventType = "payment.refunded"
+)
+
+// PaymentEvent is a message of the payment topic. EventID is unique per
+// event, redeliveries of an event keep it. Amount is optional; when set it
+// must equal the order total, or the refund of the return. A refund with a
+// ReturnID settles that return only.
+type PaymentEvent struct {
+	EventID    string           `json:"event_id"`
+	Type       PaymentEventType `json:"type"`
+	OrderID    int64            `json:"order_id,string"`
+	ReturnID   int64            `json:"return_id,string,omitempty"`
+	Amount     Money            `json:"amount"`
+	OccurredAt time.Time        `json:"occurred_at"`
+}
+
+// ProcessedPaymentEvent records that a payment event was handled and what
+// it did to its order. Outcome is "applied" or "ignored".
+type ProcessedPaymentEvent struct {
+	EventID     string           `json:"event_id"`
+	OrderID     int64            `json:"order_id,string"`
+	Type        PaymentEventType `json:"type"`
+	Outcome     string           `json:"outcome"`
+	ProcessedAt time.Time        `json:"processed_at"`
+}
+
+// PaymentRequest asks the payment service to collect the total of an order.
+// The order ID doubles as the idempotency key of the request.
+type PaymentRequest struct {
+	OrderID int64 `json:"order_id,string"`
+	UserID  int   `json:"user_id"`
+	Amount  Money `json:"amount"`
+}
@@ -1,8 +1,16 @@
 package entity
 
+// Pricing is the unit pricing of a product. The pricing service sends plain
+// numbers, which are read as DefaultCurrency amounts.
 type Pricing struct {
-	ProductID int `json:"product_id"`
-	Markup float64 `json:"markup"`
-	Discount float64 `json:"discount"`
-	FinalPrice float64 `json:"final_price"`
-}
\ No newline at end of file
+	ProductID  int   `json:"product_id"`
+	Markup     Money `json:"markup"`
+	Discount   Money `json:"discount"`
+	FinalPrice Money `json:"final_price"`
+	// TaxCategory selects the tax rule of the product, such as "standard"
+	// or "exempt".
+	TaxCategory string `json:"tax_category,omitempty"`
+	// Stale is set when the pricing service was unavailable and this is the
+	// last price it returned.
+	Stale bool `json:"-"`
+}
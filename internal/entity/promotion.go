@@ -0,0 +1,40 @@
+package entity
+
+import "time"
+
+type PromotionType string
+
+const (
+	// PromotionPercentage takes PercentOff percent off every eligible line.
+	PromotionPercentage PromotionType = "percentage"
+	// PromotionFixed takes AmountOff off the eligible lines, split in
+	// proportion to their prices.
+	PromotionFixed PromotionType = "fixed"
+	// PromotionBuyXGetY makes GetQuantity of every BuyQuantity+GetQuantity
+	// units of an eligible line free.
+	PromotionBuyXGetY PromotionType = "buy_x_get_y"
+)
+
+// Promotion is a coupon definition. Amounts are in the base currency and
+// converted with the order's rate. Zero limits and times are unbounded.
+type Promotion struct {
+	Code        string        `json:"code"`
+	Type        PromotionType `json:"type"`
+	PercentOff  int           `json:"percent_off,omitempty"`
+	AmountOff   Money         `json:"amount_off"`
+	BuyQuantity int           `json:"buy_quantity,omitempty"`
+	GetQuantity int           `json:"get_quantity,omitempty"`
+	// ProductIDs restricts the promotion to these products.
+	ProductIDs   []int     `json:"product_ids,omitempty"`
+	MinBasket    Money     `json:"min_basket"`
+	PerUserLimit int       `json:"per_user_limit,omitempty"`
+	GlobalLimit  int       `json:"global_limit,omitempty"`
+	StartsAt     time.Time `json:"starts_at"`
+	EndsAt       time.Time `json:"ends_at"`
+}
+
+// LinePromotion is the part of a line's promotion discount one coupon gave.
+type LinePromotion struct {
+	Code     string `json:"code"`
+	Discount Money  `json:"discount"`
+}
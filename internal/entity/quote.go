@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// Quote locks the pricing of a cart until ExpiresAt. An order created with
+// the quote ID is charged these prices instead of the current ones.
+type Quote struct {
+	ID     string      `json:"id"`
+	UserID int         `json:"user_id"`
+	Lines  []QuoteLine `json:"lines"`
+	// Currency and FXRate lock the conversion of the quoted prices, which
+	// are in the base currency.
+	Currency string `json:"currency"`
+	FXRate   FXRate `json:"fx_rate"`
+	// PriceFallback is set when some line was priced with a last known
+	// price because the pricing service was down.
+	PriceFallback bool      `json:"price_fallback"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// QuoteLine holds the base currency Pricing the order is priced from, and
+// the same pricing converted into the quote currency for display.
+type QuoteLine struct {
+	ProductID    int     `json:"product_id"`
+	Quantity     int     `json:"quantity"`
+	Pricing      Pricing `json:"pricing"`
+	LocalPricing Pricing `json:"local_pricing"`
+}
@@ -0,0 +1,23 @@
+package entity
+
+import "time"
+
+// SalesReport sums the orders created in [From, To) that were paid and not
+// refunded in full, less their refunded returns. Total is in BaseCurrency,
+// using the rate stored on each order.
+type SalesReport struct {
+	BaseCurrency string          `json:"base_currency"`
+	From         time.Time       `json:"from"`
+	To           time.Time       `json:"to"`
+	Orders       int             `json:"orders"`
+	Total        Money           `json:"total"`
+	ByCurrency   []CurrencyTotal `json:"by_currency"`
+}
+
+// CurrencyTotal sums the orders placed in one currency.
+type CurrencyTotal struct {
+	Currency  string `json:"currency"`
+	Orders    int    `json:"orders"`
+	Total     Money  `json:"total"`
+	BaseTotal Money  `json:"base_total"`
+}
@@ -0,0 +1,36 @@
+package entity
+
+import "time"
+
+type ReservationStatus string
+
+const (
+	ReservationReserved  ReservationStatus = "reserved"
+	ReservationConverted ReservationStatus = "converted"
+	ReservationReleased  ReservationStatus = "released"
+	ReservationExpired   ReservationStatus = "expired"
+)
+
+// StockReservation holds stock for an order between creation and payment.
+type StockReservation struct {
+	OrderID   int64             `json:"order_id,string"`
+	Status    ReservationStatus `json:"status"`
+	Lines     []ReservationLine `json:"lines"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+type ReservationLine struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// StockLevel is the reservation view of a product: the stock last read from
+// the product service, how much of it is held by open reservations and how
+// much was sold recently and is held back until the stock read from the
+// product service surely accounts for it.
+type StockLevel struct {
+	ProductID   int  `json:"product_id"`
+	Available   *int `json:"available"`
+	Reserved    int  `json:"reserved"`
+	Unconfirmed int  `json:"unconfirmed"`
+}
@@ -0,0 +1,39 @@
+package entity
+
+import "time"
+
+type ReturnStatus string
+
+const (
+	ReturnRequested ReturnStatus = "requested"
+	ReturnApproved  ReturnStatus = "approved"
+	ReturnRejected  ReturnStatus = "rejected"
+	ReturnRefunded  ReturnStatus = "refunded"
+)
+
+// ReturnRequest asks to return Quantity units of one line of a paid order.
+// LineIndex is the position of the line in ProductRequests. The refund
+// amounts are the line's charged amounts for the returned units: the
+// original MarkUp, the Discount and coupon discounts taken off, and Tax.
+// RefundAmount is what goes back to the buyer, exclusive tax included.
+// They are estimates until the return is approved.
+type ReturnRequest struct {
+	ReturnID       int64        `json:"return_id,string"`
+	OrderID        int64        `json:"order_id,string"`
+	LineIndex      int          `json:"line_index"`
+	ProductID      int          `json:"product_id"`
+	Quantity       int          `json:"quantity"`
+	Reason         string       `json:"reason"`
+	Status         ReturnStatus `json:"status"`
+	RefundAmount   Money        `json:"refund_amount"`
+	RefundMarkUp   Money        `json:"refund_mark_up"`
+	RefundDiscount Money        `json:"refund_discount"`
+	RefundTax      Money        `json:"refund_tax"`
+	// Actor requested the return; Reviewer approved or rejected it, with
+	// Note as the reason.
+	Actor     string    `json:"actor"`
+	Reviewer  string    `json:"reviewer,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
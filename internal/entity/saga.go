@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+type SagaStatus string
+
+const (
+	SagaRunning      SagaStatus = "running"
+	SagaCompensating SagaStatus = "compensating"
+	SagaCompleted    SagaStatus = "completed"
+	SagaCompensated  SagaStatus = "compensated"
+)
+
+// CheckoutSaga is the persisted state of the checkout of one order. Step is
+// the index of the next step to run while running, and the number of steps
+// still to compensate while compensating. Order is the priced order the
+// steps work on, and Actor is who started the checkout. Version goes up
+// with every save; zero means the saga was never saved.
+type CheckoutSaga struct {
+	OrderID   int64        `json:"order_id,string"`
+	Step      int          `json:"step"`
+	Status    SagaStatus   `json:"status"`
+	Actor     string       `json:"actor"`
+	Order     *OrderEntity `json:"order"`
+	Error     string       `json:"error,omitempty"`
+	Version   int64        `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
@@ -0,0 +1,97 @@
+// Package fx provides the exchange rates orders are converted with.
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"order-service/internal/entity"
+	"os"
+	"time"
+)
+
+// rateDigits is the number of decimals kept in a rate, matching the
+// orders.fx_rate column.
+const rateDigits = 12
+
+// Provider returns the current rate between two currencies. Identical
+// currencies always convert at 1, and unknown currencies return an error
+// wrapping entity.ErrUnsupportedCurrency.
+type Provider interface {
+	Rate(ctx context.Context, from, to string) (entity.FXRate, error)
+}
+
+// StaticProvider serves fixed rates, read from a file or given in code. It
+// is meant for local runs and tests, and as a fallback when no live rate
+// source is configured.
+type StaticProvider struct {
+	base  string
+	asOf  time.Time
+	rates map[string]*big.Rat
+}
+
+// staticFile is the format of a rates file, for example
+//
+//	{"base": "IDR", "as_of": "2026-10-01T00:00:00Z", "rates": {"USD": "0.0000632", "SGD": "0.0000815"}}
+//
+// where every rate is the price of one unit of base in that currency.
+type staticFile struct {
+	Base  string            `json:"base"`
+	AsOf  time.Time         `json:"as_of"`
+	Rates map[string]string `json:"rates"`
+}
+
+// NewStaticProvider serves rates quoted against base. rates maps a currency
+// to the price of one unit of base in it.
+func NewStaticProvider(base string, asOf time.Time, rates map[string]string) (*StaticProvider, error) {
+	p := &StaticProvider{
+		base:  base,
+		asOf:  asOf,
+		rates: make(map[string]*big.Rat, len(rates)),
+	}
+	for currency, rate := range rates {
+		r, ok := new(big.Rat).SetString(rate)
+		if !ok || r.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid %s rate %q", currency, rate)
+		}
+		p.rates[currency] = r
+	}
+	p.rates[base] = big.NewRat(1, 1)
+	return p, nil
+}
+
+// LoadStaticProvider reads a rates file.
+func LoadStaticProvider(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f staticFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return NewStaticProvider(f.Base, f.AsOf, f.Rates)
+}
+
+// Rate derives cross rates through the base currency.
+func (p *StaticProvider) Rate(ctx context.Context, from, to string) (entity.FXRate, error) {
+	if from == to {
+		return entity.IdentityRate(from), nil
+	}
+	fromRate, ok := p.rates[from]
+	if !ok {
+		return entity.FXRate{}, fmt.Errorf("%w: %s", entity.ErrUnsupportedCurrency, from)
+	}
+	toRate, ok := p.rates[to]
+	if !ok {
+		return entity.FXRate{}, fmt.Errorf("%w: %s", entity.ErrUnsupportedCurrency, to)
+	}
+	rate := new(big.Rat).Quo(toRate, fromRate)
+	return entity.FXRate{
+		From: from,
+		To:   to,
+		Rate: rate.FloatString(rateDigits),
+		AsOf: p.asOf,
+	}, nil
+}
@@ -0,0 +1,113 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"order-service/internal/entity"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var asOf = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+func newProvider(t *testing.T) *StaticProvider {
+	t.Helper()
+	p, err := NewStaticProvider("IDR", asOf, map[string]string{
+		"USD": "0.0000625",
+		"SGD": "0.00008",
+		"EUR": "0.00006",
+	})
+	if err != nil {
+		t.Fatalf("NewStaticProvider: %v", err)
+	}
+	return p
+}
+
+func TestStaticProviderRate(t *testing.T) {
+	p := newProvider(t)
+	tests := []struct {
+		from, to string
+		rate     string
+	}{
+		{"IDR", "USD", "0.000062500000"},
+		{"USD", "IDR", "16000.000000000000"},
+		{"USD", "SGD", "1.280000000000"},
+		{"SGD", "USD", "0.781250000000"},
+		// rounded to rateDigits, half away from zero
+		{"EUR", "USD", "1.041666666667"},
+		{"IDR", "EUR", "0.000060000000"},
+	}
+	for _, tt := range tests {
+		rate, err := p.Rate(context.Background(), tt.from, tt.to)
+		if err != nil {
+			t.Errorf("Rate(%s, %s): %v", tt.from, tt.to, err)
+			continue
+		}
+		want := entity.FXRate{From: tt.from, To: tt.to, Rate: tt.rate, AsOf: asOf}
+		if rate != want {
+			t.Errorf("Rate(%s, %s) = %+v, want %+v", tt.from, tt.to, rate, want)
+		}
+	}
+}
+
+func TestStaticProviderIdentityRate(t *testing.T) {
+	p := newProvider(t)
+	// identical currencies convert at 1 even when the provider has no rate
+	for _, currency := range []string{"IDR", "USD", "XYZ"} {
+		rate, err := p.Rate(context.Background(), currency, currency)
+		if err != nil {
+			t.Errorf("Rate(%s, %s): %v", currency, currency, err)
+			continue
+		}
+		if rate != entity.IdentityRate(currency) {
+			t.Errorf("Rate(%s, %s) = %+v, want the identity rate", currency, currency, rate)
+		}
+	}
+}
+
+func TestStaticProviderUnsupportedCurrency(t *testing.T) {
+	p := newProvider(t)
+	for _, pair := range [][2]string{{"XYZ", "USD"}, {"USD", "XYZ"}, {"IDR", ""}} {
+		if _, err := p.Rate(context.Background(), pair[0], pair[1]); !errors.Is(err, entity.ErrUnsupportedCurrency) {
+			t.Errorf("Rate(%s, %s) = %v, want %v", pair[0], pair[1], err, entity.ErrUnsupportedCurrency)
+		}
+	}
+}
+
+func TestNewStaticProviderRejects(t *testing.T) {
+	for _, rate := range []string{"", "abc", "0", "-0.0000625"} {
+		if _, err := NewStaticProvider("IDR", asOf, map[string]string{"USD": rate}); err == nil {
+			t.Errorf("NewStaticProvider accepted the rate %q", rate)
+		}
+	}
+}
+
+func TestLoadStaticProvider(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "rates.json")
+	data := `{"base": "IDR", "as_of": "2026-10-01T00:00:00Z", "rates": {"USD": "0.0000625"}}`
+	if err := os.WriteFile(valid, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadStaticProvider(valid)
+	if err != nil {
+		t.Fatalf("LoadStaticProvider: %v", err)
+	}
+	rate, err := p.Rate(context.Background(), "USD", "IDR")
+	if err != nil {
+		t.Fatalf("Rate: %v", err)
+	}
+	if want := (entity.FXRate{From: "USD", To: "IDR", Rate: "16000.000000000000", AsOf: asOf}); rate != want {
+		t.Fatalf("Rate = %+v, want %+v", rate, want)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"base": "IDR", "rates": {"USD": "x"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadStaticProvider(invalid); err == nil {
+		t.Fatal("LoadStaticProvider accepted an invalid rate")
+	}
+}
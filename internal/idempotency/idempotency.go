@@ -0,0 +1,95 @@
+// Package idempotency stores the outcome of requests made with an
+// idempotency key so retries get the original response instead of being
+// executed again.
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+)
+
+// Record is what is stored per user and key.
+type Record struct {
+	Status      string `json:"status"`
+	Fingerprint string `json:"fingerprint"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	ETag        string `json:"etag,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// beginScript creates an in-progress record unless one exists, and returns
+// the existing record otherwise.
+var beginScript = redis.NewScript(`
+local existing = redis.call("GET", KEYS[1])
+if existing then
+	return existing
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return false
+`)
+
+type Store struct {
+	rdb     *redis.Client
+	lockTTL time.Duration
+	ttl     time.Duration
+}
+
+// NewStore keeps completed records for ttl. lockTTL bounds how long a
+// crashed request can keep its key locked.
+func NewStore(rdb *redis.Client, lockTTL, ttl time.Duration) *Store {
+	return &Store{
+		rdb:     rdb,
+		lockTTL: lockTTL,
+		ttl:     ttl,
+	}
+}
+
+func recordKey(user, key string) string {
+	return fmt.Sprintf("idempotency:%s:%s", user, key)
+}
+
+// Begin locks the key for a new request. It returns nil when the caller
+// should go ahead, or the record of an earlier request with the same key.
+func (s *Store) Begin(ctx context.Context, user, key, fingerprint string) (*Record, error) {
+	lock, err := json.Marshal(Record{Status: StatusInProgress, Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+	existing, err := beginScript.Run(ctx, s.rdb, []string{recordKey(user, key)}, lock, s.lockTTL.Milliseconds()).Text()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	record := &Record{}
+	if err := json.Unmarshal([]byte(existing), record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Complete stores the response of a request started with Begin.
+func (s *Store) Complete(ctx context.Context, user, key string, record Record) error {
+	record.Status = StatusCompleted
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, recordKey(user, key), raw, s.ttl).Err()
+}
+
+// Abort unlocks the key of a request that failed, so it can be retried.
+func (s *Store) Abort(ctx context.Context, user, key string) error {
+	return s.rdb.Del(ctx, recordKey(user, key)).Err()
+}
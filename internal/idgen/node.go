@@ -0,0 +1,103 @@
+package idgen
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog"
+)
+
+var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+// renewLeaseScript extends the lease only while this instance still holds it.
+var renewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// ClaimNode leases a free node number in Redis and returns a generator for
+// it. The lease is renewed in the background until ctx is done; if a renewal
+// finds the lease taken over, or cannot renew it in time, the generator stops
+// issuing IDs until it has leased another free node number.
+func ClaimNode(ctx context.Context, rdb *redis.Client, ttl time.Duration) (*Generator, error) {
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano())
+
+	node, key, err := leaseNode(ctx, rdb, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+	g, err := NewGenerator(node)
+	if err != nil {
+		return nil, err
+	}
+	go g.keepLease(ctx, rdb, key, owner, ttl)
+	return g, nil
+}
+
+// leaseNode takes the first free node number and returns it with its key.
+func leaseNode(ctx context.Context, rdb *redis.Client, owner string, ttl time.Duration) (int, string, error) {
+	for node := 0; node < NodeCount; node++ {
+		key := fmt.Sprintf("idgen:node:%d", node)
+		ok, err := rdb.SetNX(ctx, key, owner, ttl).Result()
+		if err != nil {
+			return 0, "", err
+		}
+		if ok {
+			logger.Info().Msgf("claimed id generator node %d", node)
+			return node, key, nil
+		}
+	}
+	return 0, "", fmt.Errorf("idgen: all %d node numbers are leased", NodeCount)
+}
+
+// keepLease renews the lease on key. key is empty while the generator has
+// no lease, and every tick then tries to lease a free node number again.
+func (g *Generator) keepLease(ctx context.Context, rdb *redis.Client, key, owner string, ttl time.Duration) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			if key != "" {
+				rdb.Del(context.Background(), key)
+			}
+			return
+		case <-ticker.C:
+			if key == "" {
+				node, newKey, err := leaseNode(ctx, rdb, owner, ttl)
+				if err != nil {
+					logger.Error().Err(err).Msg("error claiming a new id generator node")
+					continue
+				}
+				g.resume(node)
+				key, renewedAt = newKey, time.Now()
+				continue
+			}
+			renewed, err := renewLeaseScript.Run(ctx, rdb, []string{key}, owner, ttl.Milliseconds()).Int()
+			if err != nil {
+				logger.Error().Err(err).Msgf("error renewing id generator lease %s", key)
+				// past the ttl another instance may have claimed the node
+				if time.Since(renewedAt) >= ttl {
+					logger.Error().Msgf("id generator lease %s expired, no IDs will be issued until another node is claimed", key)
+					g.disable()
+					key = ""
+				}
+				continue
+			}
+			if renewed == 0 {
+				logger.Error().Msgf("id generator lease %s lost, no IDs will be issued until another node is claimed", key)
+				g.disable()
+				key = ""
+				continue
+			}
+			renewedAt = time.Now()
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Package lease provides Redis leases that let one instance at a time run a
+// background job.
+package lease
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// acquireScript takes the lease when it is free and extends it when the
+// caller already holds it.
+var acquireScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type Lease struct {
+	rdb   *redis.Client
+	key   string
+	owner string
+	ttl   time.Duration
+}
+
+func New(rdb *redis.Client, key string, ttl time.Duration) *Lease {
+	hostname, _ := os.Hostname()
+	return &Lease{
+		rdb:   rdb,
+		key:   key,
+		owner: fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano()),
+		ttl:   ttl,
+	}
+}
+
+// Acquire takes or renews the lease and reports whether this instance holds
+// it for the next ttl.
+func (l *Lease) Acquire(ctx context.Context) (bool, error) {
+	held, err := acquireScript.Run(ctx, l.rdb, []string{l.key}, l.owner, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return held == 1, nil
+}
+
+func (l *Lease) Release(ctx context.Context) error {
+	return releaseScript.Run(ctx, l.rdb, []string{l.key}, l.owner).Err()
+}
@@ -0,0 +1,186 @@
+// Package promotion evaluates coupon codes against priced orders and keeps
+// coupon definitions and usage counts in Redis.
+package promotion
+
+import (
+	"fmt"
+	"math/big"
+	"order-service/internal/entity"
+	"sort"
+	"time"
+)
+
+// Validate checks that a definition can be evaluated.
+func Validate(p *entity.Promotion) error {
+	if p.Code == "" {
+		return fmt.Errorf("%w: promotion needs a code", entity.ErrInvalidPromotion)
+	}
+	switch p.Type {
+	case entity.PromotionPercentage:
+		if p.PercentOff <= 0 || p.PercentOff > 100 {
+			return fmt.Errorf("%w: percent_off must be between 1 and 100", entity.ErrInvalidPromotion)
+		}
+	case entity.PromotionFixed:
+		if p.AmountOff.Amount <= 0 {
+			return fmt.Errorf("%w: amount_off must be positive", entity.ErrInvalidPromotion)
+		}
+	case entity.PromotionBuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return fmt.Errorf("%w: buy_quantity and get_quantity must be positive", entity.ErrInvalidPromotion)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", entity.ErrInvalidPromotion, p.Type)
+	}
+	if p.PerUserLimit < 0 || p.GlobalLimit < 0 {
+		return fmt.Errorf("%w: limits cannot be negative", entity.ErrInvalidPromotion)
+	}
+	if !p.EndsAt.IsZero() && !p.EndsAt.After(p.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", entity.ErrInvalidPromotion)
+	}
+	return nil
+}
+
+// Apply takes the discounts of promotions off the lines of a priced order,
+// one promotion after the other, so a later promotion discounts what the
+// earlier ones left. Every promotion must give some discount, otherwise
+// Apply returns an error wrapping entity.ErrCouponNotApplicable and leaves
+// the order unchanged.
+func Apply(order *entity.OrderEntity, promotions []*entity.Promotion, now time.Time) error {
+	lines := make([]entity.ProductRequest, len(order.ProductRequests))
+	copy(lines, order.ProductRequests)
+	for i := range lines {
+		lines[i].Promotions = append([]entity.LinePromotion(nil), lines[i].Promotions...)
+	}
+
+	for _, p := range promotions {
+		discounts, err := evaluate(p, lines, order.FXRate, now)
+		if err != nil {
+			return err
+		}
+		for i, discount := range discounts {
+			if discount.IsZero() {
+				continue
+			}
+			if lines[i].FinalPrice, err = lines[i].FinalPrice.Sub(discount); err != nil {
+				return err
+			}
+			if lines[i].PromoDiscount, err = lines[i].PromoDiscount.Add(discount); err != nil {
+				return err
+			}
+			lines[i].Promotions = append(lines[i].Promotions, entity.LinePromotion{Code: p.Code, Discount: discount})
+		}
+	}
+	order.ProductRequests = lines
+	return nil
+}
+
+// evaluate returns the discount of one promotion per line.
+func evaluate(p *entity.Promotion, lines []entity.ProductRequest, rate entity.FXRate, now time.Time) ([]entity.Money, error) {
+	if (!p.StartsAt.IsZero() && now.Before(p.StartsAt)) || (!p.EndsAt.IsZero() && !now.Before(p.EndsAt)) {
+		return nil, fmt.Errorf("%w: %s is not active", entity.ErrCouponNotApplicable, p.Code)
+	}
+
+	subtotal := entity.NewMoney(0, rate.To)
+	for _, line := range lines {
+		var err error
+		if subtotal, err = subtotal.Add(line.FinalPrice); err != nil {
+			return nil, err
+		}
+	}
+	minBasket, err := rate.Convert(p.MinBasket, entity.RoundHalfEven)
+	if err != nil {
+		return nil, err
+	}
+	if subtotal.Amount < minBasket.Amount {
+		return nil, fmt.Errorf("%w: %s needs a basket of at least %s %s", entity.ErrCouponNotApplicable, p.Code, minBasket, minBasket.Currency)
+	}
+
+	eligible := make(map[int]bool, len(p.ProductIDs))
+	for _, productID := range p.ProductIDs {
+		eligible[productID] = true
+	}
+	discounts := make([]entity.Money, len(lines))
+	var weights []int64
+	var indexes []int
+	for i, line := range lines {
+		discounts[i] = entity.NewMoney(0, rate.To)
+		if len(eligible) > 0 && !eligible[line.ProductID] {
+			continue
+		}
+		if line.FinalPrice.Amount <= 0 {
+			continue
+		}
+		switch p.Type {
+		case entity.PromotionPercentage:
+			discount, err := line.FinalPrice.MulRat(int64(p.PercentOff), 100, entity.RoundHalfEven)
+			if err != nil {
+				return nil, err
+			}
+			discounts[i] = discount
+		case entity.PromotionBuyXGetY:
+			free := line.Quantity / (p.BuyQuantity + p.GetQuantity) * p.GetQuantity
+			if free > 0 {
+				discount, err := line.FinalPrice.MulRat(int64(free), int64(line.Quantity), entity.RoundHalfEven)
+				if err != nil {
+					return nil, err
+				}
+				discounts[i] = discount
+			}
+		case entity.PromotionFixed:
+			weights = append(weights, line.FinalPrice.Amount)
+			indexes = append(indexes, i)
+		}
+	}
+
+	if p.Type == entity.PromotionFixed && len(indexes) > 0 {
+		amountOff, err := rate.Convert(p.AmountOff, entity.RoundHalfEven)
+		if err != nil {
+			return nil, err
+		}
+		for k, share := range allocate(amountOff.Amount, weights) {
+			discounts[indexes[k]] = entity.NewMoney(share, rate.To)
+		}
+	}
+
+	for _, discount := range discounts {
+		if !discount.IsZero() {
+			return discounts, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s does not apply to any line", entity.ErrCouponNotApplicable, p.Code)
+}
+
+// allocate splits amount, capped at the sum of weights, in proportion to
+// weights. Minor units lost to rounding down go to the largest remainders,
+// so the shares add up to the amount exactly.
+func allocate(amount int64, weights []int64) []int64 {
+	var total int64
+	for _, w := range weights {
+		total += w
+	}
+	if amount > total {
+		amount = total
+	}
+	shares := make([]int64, len(weights))
+	remainders := make([]int64, len(weights))
+	var given int64
+	for i, w := range weights {
+		// amount * w can overflow int64 for large baskets
+		q, r := new(big.Int).QuoRem(new(big.Int).Mul(big.NewInt(amount), big.NewInt(w)), big.NewInt(total), new(big.Int))
+		shares[i] = q.Int64()
+		remainders[i] = r.Int64()
+		given += shares[i]
+	}
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for k := 0; given < amount; k++ {
+		shares[order[k%len(order)]]++
+		given++
+	}
+	return shares
+}
@@ -0,0 +1,298 @@
+package promotion
+
+import (
+	"errors"
+	"math"
+	"order-service/internal/entity"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func usd(amount int64) entity.Money {
+	return entity.NewMoney(amount, "USD")
+}
+
+func line(productID, quantity int, price int64) entity.ProductRequest {
+	return entity.ProductRequest{ProductID: productID, Quantity: quantity, FinalPrice: usd(price)}
+}
+
+func finalPrices(order *entity.OrderEntity) []int64 {
+	prices := make([]int64, len(order.ProductRequests))
+	for i, line := range order.ProductRequests {
+		prices[i] = line.FinalPrice.Amount
+	}
+	return prices
+}
+
+func TestApply(t *testing.T) {
+	// promotion amounts are in IDR, 16000 IDR to the USD
+	idrToUSD := entity.FXRate{From: "IDR", To: "USD", Rate: "0.0000625"}
+
+	tests := []struct {
+		name       string
+		lines      []entity.ProductRequest
+		rate       entity.FXRate
+		promotions []*entity.Promotion
+		want       []int64
+		err        error
+	}{
+		{
+			name:       "percentage",
+			lines:      []entity.ProductRequest{line(1, 1, 1000), line(2, 2, 2500)},
+			promotions: []*entity.Promotion{{Code: "TEN", Type: entity.PromotionPercentage, PercentOff: 10}},
+			want:       []int64{900, 2250},
+		},
+		{
+			name:       "percentage rounds half to even",
+			lines:      []entity.ProductRequest{line(1, 1, 125), line(2, 1, 135)},
+			promotions: []*entity.Promotion{{Code: "TEN", Type: entity.PromotionPercentage, PercentOff: 10}},
+			want:       []int64{113, 121},
+		},
+		{
+			name:       "fixed split by line price",
+			lines:      []entity.ProductRequest{line(1, 1, 1000), line(2, 1, 3000)},
+			promotions: []*entity.Promotion{{Code: "FIVE", Type: entity.PromotionFixed, AmountOff: usd(500)}},
+			want:       []int64{875, 2625},
+		},
+		{
+			name:       "fixed capped at the basket",
+			lines:      []entity.ProductRequest{line(1, 1, 300), line(2, 1, 200)},
+			promotions: []*entity.Promotion{{Code: "BIG", Type: entity.PromotionFixed, AmountOff: usd(10000)}},
+			want:       []int64{0, 0},
+		},
+		{
+			name:  "fixed in the base currency",
+			lines: []entity.ProductRequest{line(1, 1, 1000), line(2, 1, 1000)},
+			rate:  idrToUSD,
+			promotions: []*entity.Promotion{{
+				Code: "IDR", Type: entity.PromotionFixed,
+				AmountOff: entity.NewMoney(1600000, "IDR"), MinBasket: entity.NewMoney(3200000, "IDR"),
+			}},
+			want: []int64{950, 950},
+		},
+		{
+			name:       "buy two get one",
+			lines:      []entity.ProductRequest{line(1, 7, 700), line(2, 2, 200)},
+			promotions: []*entity.Promotion{{Code: "B2G1", Type: entity.PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1}},
+			want:       []int64{500, 200},
+		},
+		{
+			name:  "eligible products only",
+			lines: []entity.ProductRequest{line(1, 1, 1000), line(2, 1, 1000)},
+			promotions: []*entity.Promotion{{
+				Code: "TWO", Type: entity.PromotionPercentage, PercentOff: 50, ProductIDs: []int{2},
+			}},
+			want: []int64{1000, 500},
+		},
+		{
+			name:  "stacked on what the previous left",
+			lines: []entity.ProductRequest{line(1, 1, 1000), line(2, 1, 3000)},
+			promotions: []*entity.Promotion{
+				{Code: "TEN", Type: entity.PromotionPercentage, PercentOff: 10},
+				{Code: "FOUR", Type: entity.PromotionFixed, AmountOff: usd(400)},
+			},
+			want: []int64{800, 2400},
+		},
+		{
+			name:  "min basket met",
+			lines: []entity.ProductRequest{line(1, 1, 1000)},
+			promotions: []*entity.Promotion{{
+				Code: "TEN", Type: entity.PromotionPercentage, PercentOff: 10, MinBasket: usd(1000),
+			}},
+			want: []int64{900},
+		},
+		{
+			name:  "min basket not met",
+			lines: []entity.ProductRequest{line(1, 1, 999)},
+			promotions: []*entity.Promotion{{
+				Code: "TEN", Type: entity.PromotionPercentage, PercentOff: 10, MinBasket: usd(1000),
+			}},
+			err: entity.ErrCouponNotApplicable,
+		},
+		{
+			name:  "min basket not met in the base currency",
+			lines: []entity.ProductRequest{line(1, 1, 1000)},
+			rate:  idrToUSD,
+			promotions: []*entity.Promotion{{
+				Code: "TEN", Type: entity.PromotionPercentage, PercentOff: 10, MinBasket: entity.NewMoney(16016000, "IDR"),
+			}},
+			err: entity.ErrCouponNotApplicable,
+		},
+		{
+			name:  "min basket counts after earlier promotions",
+			lines: []entity.ProductRequest{line(1, 1, 1000)},
+			promotions: []*entity.Promotion{
+				{Code: "TEN", Type: entity.PromotionPercentage, PercentOff: 10},
+				{Code: "MIN", Type: entity.PromotionFixed, AmountOff: usd(100), MinBasket: usd(1000)},
+			},
+			err: entity.ErrCouponNotApplicable,
+		},
+		{
+			name:  "not started",
+			lines: []entity.ProductRequest{line(1, 1, 1000)},
+			promotions: []*entity.Promotion{{
+				Code: "SOON", Type: entity.PromotionPercentage, PercentOff: 10, StartsAt: now.Add(time.Second),
+			}},
+			err: entity.ErrCouponNotApplicable,
+		},
+		{
+			name:  "started",
+			lines: []entity.ProductRequest{line(1, 1, 1000)},
+			promotions: []*entity.Promotion{{
+				Code: "NOW", Type: entity.PromotionPercentage, PercentOff: 10, StartsAt: now, EndsAt: now.Add(time.Hour),
+			}},
+			want: []int64{900},
+		},
+		{
+			name:  "ended",
+			lines: []entity.ProductRequest{line(1, 1, 1000)},
+			promotions: []*entity.Promotion{{
+				Code: "OVER", Type: entity.PromotionPercentage, PercentOff: 10, StartsAt: now.Add(-time.Hour), EndsAt: now,
+			}},
+			err: entity.ErrCouponNotApplicable,
+		},
+		{
+			name:  "no eligible line",
+			lines: []entity.ProductRequest{line(1, 1, 1000)},
+			promotions: []*entity.Promotion{{
+				Code: "OTHER", Type: entity.PromotionPercentage, PercentOff: 10, ProductIDs: []int{2},
+			}},
+			err: entity.ErrCouponNotApplicable,
+		},
+		{
+			name:       "too few for a free item",
+			lines:      []entity.ProductRequest{line(1, 2, 200)},
+			promotions: []*entity.Promotion{{Code: "B2G1", Type: entity.PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1}},
+			err:        entity.ErrCouponNotApplicable,
+		},
+		{
+			name:  "later promotion that does not apply",
+			lines: []entity.ProductRequest{line(1, 1, 1000)},
+			promotions: []*entity.Promotion{
+				{Code: "TEN", Type: entity.PromotionPercentage, PercentOff: 10},
+				{Code: "OTHER", Type: entity.PromotionPercentage, PercentOff: 10, ProductIDs: []int{2}},
+			},
+			err: entity.ErrCouponNotApplicable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate := tt.rate
+			if rate.Rate == "" {
+				rate = entity.IdentityRate("USD")
+			}
+			order := &entity.OrderEntity{ProductRequests: tt.lines, FXRate: rate}
+			before := finalPrices(order)
+
+			err := Apply(order, tt.promotions, now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Apply = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if got := finalPrices(order); !reflect.DeepEqual(got, before) {
+					t.Fatalf("Apply failed but changed the final prices from %v to %v", before, got)
+				}
+				return
+			}
+			if got := finalPrices(order); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("final prices = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyRecordsEveryPromotionPerLine(t *testing.T) {
+	original := []entity.ProductRequest{line(1, 1, 1000), line(2, 1, 3000)}
+	order := &entity.OrderEntity{
+		ProductRequests: append([]entity.ProductRequest(nil), original...),
+		FXRate:          entity.IdentityRate("USD"),
+	}
+	promotions := []*entity.Promotion{
+		{Code: "TEN", Type: entity.PromotionPercentage, PercentOff: 10, ProductIDs: []int{2}},
+		{Code: "FOUR", Type: entity.PromotionFixed, AmountOff: usd(400)},
+	}
+	if err := Apply(order, promotions, now); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	// FOUR splits 400 over 1000 and 2700
+	want := []struct {
+		discount   int64
+		promotions []entity.LinePromotion
+	}{
+		{108, []entity.LinePromotion{{Code: "FOUR", Discount: usd(108)}}},
+		{592, []entity.LinePromotion{{Code: "TEN", Discount: usd(300)}, {Code: "FOUR", Discount: usd(292)}}},
+	}
+	for i, line := range order.ProductRequests {
+		if line.PromoDiscount != usd(want[i].discount) {
+			t.Errorf("line %d promo discount = %d, want %d", i, line.PromoDiscount.Amount, want[i].discount)
+		}
+		if !reflect.DeepEqual(line.Promotions, want[i].promotions) {
+			t.Errorf("line %d promotions = %+v, want %+v", i, line.Promotions, want[i].promotions)
+		}
+		if line.FinalPrice.Amount+line.PromoDiscount.Amount != original[i].FinalPrice.Amount {
+			t.Errorf("line %d final price %d and promo discount %d do not add up to %d",
+				i, line.FinalPrice.Amount, line.PromoDiscount.Amount, original[i].FinalPrice.Amount)
+		}
+	}
+	for i, line := range original {
+		if line.Promotions != nil {
+			t.Errorf("Apply changed the caller's line %d", i)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{"exact", 400, []int64{1000, 3000}, []int64{100, 300}},
+		{"remainder to the first of equal remainders", 100, []int64{50, 50, 50}, []int64{34, 33, 33}},
+		{"remainder to the largest remainder", 10, []int64{10, 20, 30}, []int64{2, 3, 5}},
+		{"capped at the weights", 50, []int64{10, 20}, []int64{10, 20}},
+		{"nothing", 0, []int64{10, 20}, []int64{0, 0}},
+		{"single weight", 7, []int64{3}, []int64{3}},
+		{"no overflow", 1 << 40, []int64{1 << 40, 1 << 40}, []int64{1 << 39, 1 << 39}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allocate(tt.amount, tt.weights); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("allocate(%d, %v) = %v, want %v", tt.amount, tt.weights, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocateSharesAddUp(t *testing.T) {
+	weightSets := [][]int64{
+		{1, 1, 1},
+		{3, 7, 11},
+		{999, 1, 1},
+		{1, 2, 3, 4, 5, 6, 7},
+		{math.MaxInt64 / 4, math.MaxInt64 / 4, 3},
+	}
+	for _, weights := range weightSets {
+		var total int64
+		for _, w := range weights {
+			total += w
+		}
+		for _, amount := range []int64{0, 1, 2, 5, 17, 100, 1001, total - 1, total, total + 1} {
+			var sum int64
+			for _, share := range allocate(amount, weights) {
+				if share < 0 {
+					t.Fatalf("allocate(%d, %v) gives a negative share", amount, weights)
+				}
+				sum += share
+			}
+			if want := min(amount, total); sum != want {
+				t.Fatalf("allocate(%d, %v) shares add up to %d, want %d", amount, weights, sum, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package promotion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"order-service/internal/entity"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redeemScript counts one use of every coupon of an order, or none.
+// KEYS: redemption, then global and per-user usage key per coupon
+// ARGV: codes json, then global and per-user limit per coupon (0 is unlimited)
+// returns 0 when redeemed or already redeemed for the order, and the index
+// of the first coupon over a limit otherwise.
+var redeemScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+local n = (#KEYS - 1) / 2
+for i = 1, n do
+	local globalLimit = tonumber(ARGV[2 * i])
+	local userLimit = tonumber(ARGV[1 + 2 * i])
+	if globalLimit > 0 and tonumber(redis.call("GET", KEYS[2 * i]) or "0") >= globalLimit then
+		return i
+	end
+	if userLimit > 0 and tonumber(redis.call("GET", KEYS[1 + 2 * i]) or "0") >= userLimit then
+		return i
+	end
+end
+for i = 1, n do
+	redis.call("INCR", KEYS[2 * i])
+	redis.call("INCR", KEYS[1 + 2 * i])
+end
+redis.call("SET", KEYS[1], ARGV[1])
+return 0
+`)
+
+// releaseScript gives the uses of an order's coupons back, once.
+// KEYS: redemption, then global and per-user usage key per coupon
+var releaseScript = redis.NewScript(`
+if redis.call("DEL", KEYS[1]) == 0 then
+	return 0
+end
+for i = 2, #KEYS do
+	redis.call("DECR", KEYS[i])
+end
+return 1
+`)
+
+// Store keeps coupon definitions (promotion:<code>) and their usage counts.
+// Every order that redeemed coupons has a redemption record, which makes
+// redeeming and releasing the same order again a no-op.
+type Store struct {
+	rdb *redis.Client
+}
+
+func NewStore(rdb *redis.Client) *Store {
+	return &Store{
+		rdb: rdb,
+	}
+}
+
+// NormalizeCode makes codes case-insensitive.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func promotionKey(code string) string {
+	return fmt.Sprintf("promotion:%s", code)
+}
+
+func globalUsesKey(code string) string {
+	return fmt.Sprintf("promotion:%s:uses", code)
+}
+
+func userUsesKey(code string, userID int) string {
+	return fmt.Sprintf("promotion:%s:user:%d", code, userID)
+}
+
+func redemptionKey(orderID int64) string {
+	return fmt.Sprintf("promotion:redemption:%d", orderID)
+}
+
+// Save creates or replaces a coupon definition. Usage counts are kept.
+func (s *Store) Save(ctx context.Context, p *entity.Promotion) error {
+	p.Code = NormalizeCode(p.Code)
+	if err := Validate(p); err != nil {
+		return err
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, promotionKey(p.Code), data, 0).Err()
+}
+
+// Get returns the definitions of codes in the same order. Unknown codes
+// return an error wrapping entity.ErrCouponNotFound.
+func (s *Store) Get(ctx context.Context, codes []string) ([]*entity.Promotion, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, len(codes))
+	for i, code := range codes {
+		keys[i] = promotionKey(code)
+	}
+	values, err := s.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	promotions := make([]*entity.Promotion, len(codes))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", entity.ErrCouponNotFound, codes[i])
+		}
+		p := &entity.Promotion{}
+		if err := json.Unmarshal([]byte(data), p); err != nil {
+			return nil, err
+		}
+		promotions[i] = p
+	}
+	return promotions, nil
+}
+
+// Redeem counts one use of every promotion for the order's user, checking
+// every limit and taking every use in one step. It returns an error
+// wrapping entity.ErrCouponLimitReached, and takes nothing, when any
+// promotion is used up.
+func (s *Store) Redeem(ctx context.Context, orderID int64, userID int, promotions []*entity.Promotion) error {
+	if len(promotions) == 0 {
+		return nil
+	}
+	codes := make([]string, len(promotions))
+	for i, p := range promotions {
+		codes[i] = p.Code
+	}
+	codesJSON, err := json.Marshal(codes)
+	if err != nil {
+		return err
+	}
+	args := []interface{}{codesJSON}
+	for _, p := range promotions {
+		args = append(args, p.GlobalLimit, p.PerUserLimit)
+	}
+	res, err := redeemScript.Run(ctx, s.rdb, usageKeys(orderID, userID, codes), args...).Int()
+	if err != nil {
+		return err
+	}
+	if res > 0 {
+		return fmt.Errorf("%w: %s", entity.ErrCouponLimitReached, codes[res-1])
+	}
+	return nil
+}
+
+// Release gives back the uses an order took, for example when it could not
+// be stored or was cancelled.
+func (s *Store) Release(ctx context.Context, orderID int64, userID int, codes []string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+	return releaseScript.Run(ctx, s.rdb, usageKeys(orderID, userID, codes)).Err()
+}
+
+func usageKeys(orderID int64, userID int, codes []string) []string {
+	keys := []string{redemptionKey(orderID)}
+	for _, code := range codes {
+		keys = append(keys, globalUsesKey(code), userUsesKey(code, userID))
+	}
+	return keys
+}
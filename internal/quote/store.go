@@ -0,0 +1,118 @@
+// Package quote stores price quotes in Redis. Quotes are signed with an
+// HMAC so a quote edited in Redis is rejected instead of honoured.
+package quote
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"order-service/internal/entity"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// expiredGrace is how long a quote is kept after it expires, so a late
+// checkout is told the quote expired rather than that it does not exist.
+const expiredGrace = time.Hour
+
+// record is what is stored per quote.
+type record struct {
+	Quote     json.RawMessage `json:"quote"`
+	Signature string          `json:"signature"`
+}
+
+type Store struct {
+	rdb    *redis.Client
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewStore signs quotes with secret and makes them valid for ttl.
+func NewStore(rdb *redis.Client, secret []byte, ttl time.Duration) *Store {
+	return &Store{
+		rdb:    rdb,
+		secret: secret,
+		ttl:    ttl,
+	}
+}
+
+func quoteKey(id string) string {
+	return fmt.Sprintf("quote:%s", id)
+}
+
+// Save assigns the quote an ID and expiry, signs and stores it.
+func (s *Store) Save(ctx context.Context, quote *entity.Quote) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	quote.ID = hex.EncodeToString(id)
+	quote.CreatedAt = time.Now().UTC()
+	quote.ExpiresAt = quote.CreatedAt.Add(s.ttl)
+
+	payload, err := json.Marshal(quote)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record{Quote: payload, Signature: s.sign(payload)})
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, quoteKey(quote.ID), data, s.ttl+expiredGrace).Err()
+}
+
+// Get returns a valid quote. It returns entity.ErrInvalidQuote when the
+// quote is unknown or its signature does not match, and
+// entity.ErrQuoteExpired once it expired.
+func (s *Store) Get(ctx context.Context, id string) (*entity.Quote, error) {
+	data, err := s.rdb.Get(ctx, quoteKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, entity.ErrInvalidQuote
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, entity.ErrInvalidQuote
+	}
+	if !hmac.Equal([]byte(rec.Signature), []byte(s.sign(rec.Quote))) {
+		return nil, entity.ErrInvalidQuote
+	}
+	quote := &entity.Quote{}
+	if err := json.Unmarshal(rec.Quote, quote); err != nil {
+		return nil, entity.ErrInvalidQuote
+	}
+	if quote.ID != id {
+		return nil, entity.ErrInvalidQuote
+	}
+	if !time.Now().Before(quote.ExpiresAt) {
+		return nil, entity.ErrQuoteExpired
+	}
+	return quote, nil
+}
+
+// Consume marks a quote used. Only one caller consumes a quote; the others,
+// and later calls to Get, get entity.ErrInvalidQuote.
+func (s *Store) Consume(ctx context.Context, id string) error {
+	deleted, err := s.rdb.Del(ctx, quoteKey(id)).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return fmt.Errorf("%w: quote already used", entity.ErrInvalidQuote)
+	}
+	return nil
+}
+
+func (s *Store) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"database/sql"
+	"order-service/internal/entity"
+	"time"
+)
+
+// amount receives a DECIMAL column as text. It becomes entity.Money once
+// the row's currency, which decides the minor unit, is known.
+type amount string
+
+func (a amount) money(currency string) (entity.Money, error) {
+	return entity.ParseMoney(string(a), currency, entity.RoundHalfEven)
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
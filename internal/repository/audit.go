@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"order-service/internal/entity"
+	"time"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ListOrderEvents returns the audit log of an order, oldest first. The log
+// outlives the order, so a deleted order still has one.
+func (r *OrderRepository) ListOrderEvents(orderID int64) ([]entity.OrderEvent, error) {
+	dbindex := r.router.GetShard(orderID)
+	db := r.dbShards[dbindex]
+	return readOrderEvents(db, []int64{orderID})
+}
+
+// snapshotOrder reads the order as stored in tx, with its lines, and locks
+// its row until tx ends. It returns nil when there is no order.
+func (r *OrderRepository) snapshotOrder(tx *sql.Tx, orderID int64) (json.RawMessage, error) {
+	order, err := scanOrder(tx.QueryRow(`SELECT `+orderColumns+` FROM orders WHERE order_id = ? FOR UPDATE`, orderID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadProductRequests(tx, []*entity.OrderEntity{order}); err != nil {
+		return nil, err
+	}
+	return json.Marshal(order)
+}
+
+// auditOrder records that actor changed an order in tx. before is the
+// snapshot taken before the change; the after snapshot is read back from
+// tx.
+func (r *OrderRepository) auditOrder(tx *sql.Tx, orderID int64, actor, action string, before json.RawMessage) error {
+	after, err := r.snapshotOrder(tx, orderID)
+	if err != nil {
+		return err
+	}
+	return insertOrderEvent(tx, &entity.OrderEvent{
+		OrderID:   orderID,
+		Actor:     actor,
+		Action:    action,
+		Before:    before,
+		After:     after,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// auditReturn records that actor changed a return in tx. before is nil
+// for a new return.
+func auditReturn(tx *sql.Tx, ret *entity.ReturnRequest, actor, action string, before *entity.ReturnRequest) error {
+	event := &entity.OrderEvent{
+		OrderID:   ret.OrderID,
+		Actor:     actor,
+		Action:    action,
+		CreatedAt: time.Now().UTC(),
+	}
+	var err error
+	if before != nil {
+		if event.Before, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	if event.After, err = json.Marshal(ret); err != nil {
+		return err
+	}
+	return insertOrderEvent(tx, event)
+}
+
+// insertOrderEvent appends an event to the log, giving it an ID if it has
+// none. An event that is already in the log, because it was copied before,
+// is left as it is.
+func insertOrderEvent(tx execer, event *entity.OrderEvent) error {
+	if event.EventID == "" {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		event.EventID = hex.EncodeToString(id)
+	}
+	query := `INSERT IGNORE INTO order_events(event_id, order_id, actor, action, before_state, after_state, created_at)VALUES(?, ?, ?, ?, ?, ?, ?)`
+	_, err := tx.Exec(query, event.EventID, event.OrderID, event.Actor, event.Action, nullJSON(event.Before), nullJSON(event.After), event.CreatedAt)
+	return err
+}
+
+const orderEventColumns = `id, event_id, order_id, actor, action, before_state, after_state, created_at`
+
+func readOrderEvents(db *sql.DB, orderIDs []int64) ([]entity.OrderEvent, error) {
+	placeholders, args := inClause(orderIDs)
+	events, _, err := queryOrderEvents(db, `SELECT `+orderEventColumns+` FROM order_events WHERE order_id IN (`+placeholders+`) ORDER BY id`, args...)
+	return events, err
+}
+
+// queryOrderEvents runs a query for orderEventColumns and also returns the
+// shard-local id of the last event read.
+func queryOrderEvents(db *sql.DB, query string, args ...interface{}) ([]entity.OrderEvent, int64, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var events []entity.OrderEvent
+	var lastID int64
+	for rows.Next() {
+		e := entity.OrderEvent{}
+		var before, after []byte
+		if err := rows.Scan(&lastID, &e.EventID, &e.OrderID, &e.Actor, &e.Action, &before, &after, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if before != nil {
+			e.Before = before
+		}
+		if after != nil {
+			e.After = after
+		}
+		events = append(events, e)
+	}
+	return events, lastID, rows.Err()
+}
+
+// nullJSON stores a missing snapshot as NULL.
+func nullJSON(snapshot json.RawMessage) interface{} {
+	if snapshot == nil {
+		return nil
+	}
+	return []byte(snapshot)
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"order-service/internal/entity"
+	"time"
+)
+
+// lineCancelledEvent is the payload of a "line_cancelled" event: the order
+// as it is after the change, plus the change itself.
+type lineCancelledEvent struct {
+	*entity.OrderEntity
+	LineChange entity.LineChange `json:"line_change"`
+}
+
+// UpdateOrderLines stores the lines and totals of an order after one of its
+// lines was cancelled or reduced, records the change and queues a
+// "line_cancelled" event. The change.Actor is recorded in the audit log. It
+// returns entity.ErrVersionMismatch when the order changed since it was
+// read, and raises its version.
+func (r *OrderRepository) UpdateOrderLines(order *entity.OrderEntity, change *entity.LineChange) error {
+	db, err := r.writeDB(order.OrderID)
+	if err != nil {
+		return err
+	}
+	// start transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	before, err := r.snapshotOrder(tx, order.OrderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	orderQuery := `UPDATE orders SET quantity = ?, total = ?, total_mark_up = ?, total_discount = ?, base_total = ?, total_tax = ?, version = version + 1
+		WHERE order_id = ? AND version = ?`
+	res, err := tx.Exec(orderQuery, order.Quantity, order.Total, order.TotalMarkUp, order.TotalDiscount, order.BaseTotal, order.TotalTax, order.OrderID, order.Version)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := checkVersionUpdated(res); err != nil {
+		tx.Rollback()
+		return err
+	}
+	order.Version++
+
+	_, err = tx.Exec(`DELETE FROM product_requests WHERE order_id = ?`, order.OrderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := insertProductRequests(tx, order.OrderID, order.ProductRequests); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := insertLineChange(tx, change); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	payload, err := json.Marshal(lineCancelledEvent{OrderEntity: order, LineChange: *change})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := insertOutboxPayload(tx, order.OrderID, "line_cancelled", payload); err != nil {
+		tx.Rollback()
+		return err
+	}
+	action := "line_reduced"
+	if change.ToQuantity == 0 {
+		action = "line_cancelled"
+	}
+	if err := r.auditOrder(tx, order.OrderID, change.Actor, action, before); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	r.replicate(order.OrderID)
+	return nil
+}
+
+func (r *OrderRepository) ListLineChanges(orderID int64) ([]entity.LineChange, error) {
+	dbindex := r.router.GetShard(orderID)
+	db := r.dbShards[dbindex]
+	return readLineChanges(db, []int64{orderID})
+}
+
+func insertLineChange(tx *sql.Tx, change *entity.LineChange) error {
+	if change.CreatedAt.IsZero() {
+		change.CreatedAt = time.Now().UTC()
+	}
+	query := `INSERT INTO order_line_changes(order_id, line_index, product_id, from_quantity, to_quantity, actor, reason, created_at)VALUES(?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := tx.Exec(query, change.OrderID, change.Index, change.ProductID, change.FromQuantity, change.ToQuantity, change.Actor, change.Reason, change.CreatedAt)
+	return err
+}
+
+func readLineChanges(db *sql.DB, orderIDs []int64) ([]entity.LineChange, error) {
+	placeholders, args := inClause(orderIDs)
+	query := `SELECT order_id, line_index, product_id, from_quantity, to_quantity, actor, reason, created_at FROM order_line_changes WHERE order_id IN (` + placeholders + `) ORDER BY id`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []entity.LineChange
+	for rows.Next() {
+		c := entity.LineChange{}
+		if err := rows.Scan(&c.OrderID, &c.Index, &c.ProductID, &c.FromQuantity, &c.ToQuantity, &c.Actor, &c.Reason, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
@@ -3,10 +3,29 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"order-service/internal/entity"
 	"order-service/internal/sharding"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
 )
 
+var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+// orderColumns is the column list scanned by scanOrder.
+const orderColumns = `id, user_id, order_id, quantity, total, status, total_mark_up, total_discount, created_at, price_fallback, quote_id, currency, base_currency, fx_rate, fx_rate_at, base_total, coupon_codes, shipping_region, total_tax, version`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
 type OrderRepository struct {
 	//db *sql.DB
 	dbShards []*sql.DB
@@ -20,68 +39,253 @@ func NewOrderRepository(dbShards []*sql.DB, router *sharding.ShardRouter) *Order
 	}
 }
 
-func (r *OrderRepository) GetOrderByID(id int) (*entity.OrderEntity, error) {
-	orderQuery := `SELECT id, user_id, quantity, total, status, total_mark_up, total_discount, order_id FROM orders WHERE id = ?`
-	productrequestQuery := `SELECT product_id, quantity, mark_up, discount, final_price, FROM product_requests WHERE order_id = ?`
+// writeDB returns the shard that takes writes to the order, or
+// ErrShardMoving while its slot is fenced.
+func (r *OrderRepository) writeDB(orderID int64) (*sql.DB, error) {
+	if r.router.Fenced(orderID) {
+		return nil, entity.ErrShardMoving
+	}
+	return r.dbShards[r.router.GetShard(orderID)], nil
+}
 
-	dbindex := r.router.GetShard(id)
+func (r *OrderRepository) GetOrderByID(orderID int64) (*entity.OrderEntity, error) {
+	orderQuery := `SELECT ` + orderColumns + ` FROM orders WHERE order_id = ?`
+
+	dbindex := r.router.GetShard(orderID)
 	db := r.dbShards[dbindex]
 
-	order := &entity.OrderEntity{}
-	err := db.QueryRow(orderQuery, id).Scan(&order.ID, &order.UserID, &order.OrderID, &order.Quantity, &order.Total, &order.Status, &order.TotalMarkUp, &order.TotalDiscount)
+	order, err := scanOrder(db.QueryRow(orderQuery, orderID))
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, entity.ErrOrderNotFound
+		}
 		return nil, err
 	}
-	rows, err := db.Query(productrequestQuery, id)
+	if err := r.loadProductRequests(db, []*entity.OrderEntity{order}); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// ListOrders returns up to filter.Limit+1 orders of a user, newest first.
+// Every shard is queried concurrently and the per-shard pages are merged,
+// so the extra row tells the caller whether another page exists. Order IDs
+// are time ordered, so they double as the sort key and cursor.
+func (r *OrderRepository) ListOrders(filter entity.OrderFilter) ([]*entity.OrderEntity, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE user_id = ?`
+	args := []interface{}{filter.UserID}
+	if filter.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, filter.Status)
+	}
+	if !filter.From.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		query += ` AND created_at < ?`
+		args = append(args, filter.To)
+	}
+	if filter.AfterOrderID != 0 {
+		query += ` AND order_id < ?`
+		args = append(args, filter.AfterOrderID)
+	}
+	query += ` ORDER BY order_id DESC LIMIT ?`
+	args = append(args, filter.Limit+1)
+
+	results := make([][]*entity.OrderEntity, len(r.dbShards))
+	errs := make([]error, len(r.dbShards))
+	var wg sync.WaitGroup
+	for i, db := range r.dbShards {
+		wg.Add(1)
+		go func(i int, db *sql.DB) {
+			defer wg.Done()
+			results[i], errs[i] = r.listShardOrders(i, db, query, args)
+		}(i, db)
+	}
+	wg.Wait()
+
+	var orders []*entity.OrderEntity
+	for i := range r.dbShards {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("list orders on shard %d: %w", i, errs[i])
+		}
+		orders = append(orders, results[i]...)
+	}
+
+	// merge the shard pages into a single newest-first page
+	sort.Slice(orders, func(a, b int) bool {
+		return orders[a].OrderID > orders[b].OrderID
+	})
+	if len(orders) > filter.Limit+1 {
+		orders = orders[:filter.Limit+1]
+	}
+	return orders, nil
+}
+
+// listShardOrders runs query on one shard. Rows of slots the shard does not
+// own, such as copies left behind or made ahead by resharding, are skipped.
+func (r *OrderRepository) listShardOrders(shard int, db *sql.DB, query string, args []interface{}) ([]*entity.OrderEntity, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+
+	var orders []*entity.OrderEntity
 	for rows.Next() {
-		productRequest := entity.ProductRequest{}
-		err := rows.Scan(&productRequest.ProductID, &productRequest.Quantity, &productRequest.MarkUp, &productRequest.Discount, &productRequest.FinalPrice)
+		order, err := scanOrder(rows)
 		if err != nil {
 			return nil, err
 		}
+		if r.router.GetShard(order.OrderID) != shard {
+			continue
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadProductRequests(db, orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// loadProductRequests fills ProductRequests for orders that live on db.
+func (r *OrderRepository) loadProductRequests(db querier, orders []*entity.OrderEntity) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*entity.OrderEntity, len(orders))
+	orderIDs := make([]int64, 0, len(orders))
+	for _, order := range orders {
+		byID[order.OrderID] = order
+		orderIDs = append(orderIDs, order.OrderID)
+	}
+
+	placeholders, args := inClause(orderIDs)
+	productrequestQuery := `SELECT order_id, product_id, quantity, mark_up, discount, final_price, promo_discount, promotions, tax_category, tax, tax_rate, tax_inclusive FROM product_requests WHERE order_id IN (` + placeholders + `) ORDER BY id`
+	rows, err := db.Query(productrequestQuery, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var orderID int64
+		var markUp, discount, finalPrice, promoDiscount, tax amount
+		var promotions []byte
+		productRequest := entity.ProductRequest{}
+		err := rows.Scan(&orderID, &productRequest.ProductID, &productRequest.Quantity, &markUp, &discount, &finalPrice, &promoDiscount, &promotions,
+			&productRequest.TaxCategory, &tax, &productRequest.TaxRate, &productRequest.TaxInclusive)
+		if err != nil {
+			return err
+		}
+		order, ok := byID[orderID]
+		if !ok {
+			continue
+		}
+		// line amounts are in the currency of their order
+		if productRequest.MarkUp, err = markUp.money(order.Currency); err != nil {
+			return err
+		}
+		if productRequest.Discount, err = discount.money(order.Currency); err != nil {
+			return err
+		}
+		if productRequest.FinalPrice, err = finalPrice.money(order.Currency); err != nil {
+			return err
+		}
+		if productRequest.PromoDiscount, err = promoDiscount.money(order.Currency); err != nil {
+			return err
+		}
+		if productRequest.Tax, err = tax.money(order.Currency); err != nil {
+			return err
+		}
+		if len(promotions) > 0 {
+			if err := json.Unmarshal(promotions, &productRequest.Promotions); err != nil {
+				return err
+			}
+		}
 		order.ProductRequests = append(order.ProductRequests, productRequest)
 	}
-	return order, nil
+	return rows.Err()
 }
 
-func (r *OrderRepository) UpdateOrder(order *entity.OrderEntity) (*entity.OrderEntity, error) {
-	dbindex := r.router.GetShard(order.OrderID)
-	db := r.dbShards[dbindex]
+// UpdateOrder rewrites the order and its product requests, queues an
+// "updated" event and records actor in the audit log. It returns
+// entity.ErrVersionMismatch unless the stored order is still at
+// order.Version, and raises the version. When transition is not nil the
+// status change is only applied if the stored status still equals
+// transition.From, and the transition is recorded in the same database
+// transaction.
+func (r *OrderRepository) UpdateOrder(order *entity.OrderEntity, transition *entity.StatusTransition, actor string) (*entity.OrderEntity, error) {
+	db, err := r.writeDB(order.OrderID)
+	if err != nil {
+		return nil, err
+	}
 	// start transaction
 	tx, err := db.Begin()
 	if err != nil {
 		return nil, err
 	}
+	before, err := r.snapshotOrder(tx, order.OrderID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 
 	// update order
-	orderQuery := `UPDATE orders SET user_id = ?, quantity = ?, total = ?, status = ?, total_mark_up = ?, total_discount = ? WHERE id = ?`
-	_, err = tx.Exec(orderQuery, order.UserID, order.Quantity, order.Total, order.Status, order.TotalMarkUp, order.TotalDiscount, order.ID)
+	orderQuery := `UPDATE orders SET user_id = ?, quantity = ?, total = ?, status = ?, total_mark_up = ?, total_discount = ?, base_total = ?, shipping_region = ?, total_tax = ?,
+		version = version + 1 WHERE order_id = ? AND version = ?`
+	args := []interface{}{order.UserID, order.Quantity, order.Total, order.Status, order.TotalMarkUp, order.TotalDiscount, order.BaseTotal, order.ShippingRegion, order.TotalTax,
+		order.OrderID, order.Version}
+	if transition != nil {
+		orderQuery += ` AND status = ?`
+		args = append(args, transition.From)
+	}
+	res, err := tx.Exec(orderQuery, args...)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
+	// every status change raises the version, so a changed status is a
+	// changed version too
+	if err := checkVersionUpdated(res); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	order.Version++
+	if transition != nil {
+		if err := insertStatusTransition(tx, transition); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
 
 	// DELETE existing product request
 	deleteQuery := `DELETE FROM product_requests WHERE order_id = ?`
-	_, err = tx.Exec(deleteQuery, order.ID)
+	_, err = tx.Exec(deleteQuery, order.OrderID)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
 	// insert product Request
-	productQuery := `INSERT INTO product_requests(order_id, product_id, quantity, mark_up, discount, final_price)VALUES(?, ?, ?, ?, ?, ?)`
+	err = insertProductRequests(tx, order.OrderID, order.ProductRequests)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 
-	for _, product := range order.ProductRequests {
-		_, err := tx.Exec(productQuery, order.ID, product.ProductID, product.Quantity, product.MarkUp, product.Discount, product.FinalPrice)
-		if err != nil {
-			tx.Rollback()
-			return nil, err
-		}
+	err = insertOutboxMessage(tx, order, "updated")
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := r.auditOrder(tx, order.OrderID, actor, "updated", before); err != nil {
+		tx.Rollback()
+		return nil, err
 	}
 
 	// commit transactions
@@ -89,12 +293,17 @@ func (r *OrderRepository) UpdateOrder(order *entity.OrderEntity) (*entity.OrderE
 	if err != nil {
 		return nil, err
 	}
+	r.replicate(order.OrderID)
 	return order, nil
 }
 
-func (r *OrderRepository) CreateOrder(order *entity.OrderEntity) (*entity.OrderEntity, error) {
-	dbindex := r.router.GetShard(order.OrderID)
-	db := r.dbShards[dbindex]
+// CreateOrder inserts the order and its product requests, queues a
+// "created" event and records actor in the audit log.
+func (r *OrderRepository) CreateOrder(order *entity.OrderEntity, actor string) (*entity.OrderEntity, error) {
+	db, err := r.writeDB(order.OrderID)
+	if err != nil {
+		return nil, err
+	}
 	// start transaction
 	tx, err := db.Begin()
 	if err != nil {
@@ -102,15 +311,22 @@ func (r *OrderRepository) CreateOrder(order *entity.OrderEntity) (*entity.OrderE
 	}
 
 	//insert order
-	orderQuery := `INSERT INTO orders(user_id, order_id, quantity, total, status, total_mark_up, total_discount)VALUES(?, ?, ?, ?, ?, ?, ?)`
-	res, err := tx.Exec(orderQuery, order.UserID, order.OrderID, order.Quantity, order.Total, order.Status, order.TotalMarkUp, order.TotalDiscount)
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = time.Now().UTC()
+	}
+	order.Version = 1
+	orderQuery := `INSERT INTO orders(user_id, order_id, quantity, total, status, total_mark_up, total_discount, created_at, price_fallback, quote_id,
+		currency, base_currency, fx_rate, fx_rate_at, base_total, coupon_codes, shipping_region, total_tax, version)VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := tx.Exec(orderQuery, order.UserID, order.OrderID, order.Quantity, order.Total, order.Status, order.TotalMarkUp, order.TotalDiscount, order.CreatedAt, order.PriceFallback, order.QuoteID,
+		order.Currency, order.FXRate.From, order.FXRate.Rate, nullTime(order.FXRate.AsOf), order.BaseTotal, strings.Join(order.CouponCodes, ","),
+		order.ShippingRegion, order.TotalTax, order.Version)
 
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
-	orderID, err := res.LastInsertId()
+	id, err := res.LastInsertId()
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -120,7 +336,7 @@ func (r *OrderRepository) CreateOrder(order *entity.OrderEntity) (*entity.OrderE
 	// productQuery := `INSERT INTO product_requests(order_id, product_id, quantity, mark_up, discount, final_price)VALUES(?, ?, ?, ?, ?, ?)`
 
 	// for _, product := range order.ProductRequests {
-	// 	_, err := tx.Exec(productQuery, orderID, product.ProductID, product.Quantity, product.MarkUp, product.Discount, product.FinalPrice)
+	// 	_, err := tx.Exec(productQuery, order.OrderID, product.ProductID, product.Quantity, product.MarkUp, product.Discount, product.FinalPrice)
 	// 	if err != nil {
 	// 		tx.Rollback()
 	// 		return nil, err
@@ -128,72 +344,262 @@ func (r *OrderRepository) CreateOrder(order *entity.OrderEntity) (*entity.OrderE
 	// }
 
 	// insert batch request
-	productQuery := `INSERT INTO orders(user_id, order_id, quantity, total, status, total_mark_up, total_discount)VALUES `
-	var values []interface{}
-	for _, product := range order.ProductRequests {
-		productQuery += "(?, ?, ?, ?, ?, ?),"
-		values = append(values, orderID, product.ProductID, product.Quantity, product.MarkUp, product.Discount, product.FinalPrice)
+	err = insertProductRequests(tx, order.OrderID, order.ProductRequests)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
 	}
 
-	// remove the trailing comma
-	productQuery = productQuery[:len(productQuery)-1]
-
-	// execute the query batch insert
-	_, err = tx.Exec(productQuery, values...)
+	order.ID = int(id)
+	err = insertOutboxMessage(tx, order, "created")
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
+	if err := r.auditOrder(tx, order.OrderID, actor, "created", nil); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 	// commit transactions
 	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
-	order.ID = int(orderID)
+	r.replicate(order.OrderID)
 	return order, nil
 }
-func (r *OrderRepository) DeleteOrder(id int) error {
-	dbindex := r.router.GetShard(id)
-	db := r.dbShards[dbindex]
+
+// DeleteOrder removes the order and its product requests. Its audit log
+// is kept, with the deletion by actor as the last entry.
+func (r *OrderRepository) DeleteOrder(orderID int64, actor string) error {
+	db, err := r.writeDB(orderID)
+	if err != nil {
+		return err
+	}
 	// start transaction
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
+	before, err := r.snapshotOrder(tx, orderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 	// DELETE existing product request
 	deleteQuery := `DELETE FROM product_requests WHERE order_id = ?`
-	_, err = tx.Exec(deleteQuery, id)
+	_, err = tx.Exec(deleteQuery, orderID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
 	// DELETE order
-	deleteOrderQuery := `DELETE FROM orders WHERE id = ?`
-	_, err = tx.Exec(deleteOrderQuery, id)
+	deleteOrderQuery := `DELETE FROM orders WHERE order_id = ?`
+	_, err = tx.Exec(deleteOrderQuery, orderID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
+	if err := r.auditOrder(tx, orderID, actor, "deleted", before); err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	// commit transactions
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
+	r.replicateDelete(orderID)
 
 	return nil
 }
 
-func (r *OrderRepository) UpdateOrderStatus(id int, status string) error {
-	dbindex := r.router.GetShard(id)
-	db := r.dbShards[dbindex]
+// UpdateOrderStatus moves an order from transition.From to transition.To,
+// records the transition and queues an event named after the new status.
+// It returns entity.ErrStatusChanged when the stored status is no longer
+// transition.From or the order changed since it was read.
+func (r *OrderRepository) UpdateOrderStatus(order *entity.OrderEntity, transition entity.StatusTransition) error {
+	db, err := r.writeDB(transition.OrderID)
+	if err != nil {
+		return err
+	}
 	// start transaction
-	query := `UPDATE orders SET status = ? WHERE id = ?`
-	_, err := db.Exec(query, status, id)
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
+	if err := r.updateStatus(tx, order, &transition); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	r.replicate(transition.OrderID)
+	return nil
+}
 
+// updateStatus applies a status transition inside tx and queues an event
+// named after the new status.
+func (r *OrderRepository) updateStatus(tx *sql.Tx, order *entity.OrderEntity, transition *entity.StatusTransition) error {
+	if err := r.changeStatus(tx, order, transition); err != nil {
+		return err
+	}
+	return insertOutboxMessage(tx, order, string(transition.To))
+}
+
+// changeStatus applies a status transition inside tx and records it in the
+// audit log, for callers that queue their own event about it. The order
+// must still be at order.Version, whose version is raised.
+func (r *OrderRepository) changeStatus(tx *sql.Tx, order *entity.OrderEntity, transition *entity.StatusTransition) error {
+	before, err := r.snapshotOrder(tx, transition.OrderID)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE orders SET status = ?, version = version + 1 WHERE order_id = ? AND status = ? AND version = ?`
+	res, err := tx.Exec(query, transition.To, transition.OrderID, transition.From, order.Version)
+	if err != nil {
+		return err
+	}
+	if err := checkStatusUpdated(res); err != nil {
+		return err
+	}
+	order.Version++
+	if err := insertStatusTransition(tx, transition); err != nil {
+		return err
+	}
+	if err := r.auditOrder(tx, transition.OrderID, transition.Actor, "status_changed", before); err != nil {
+		return err
+	}
+	order.Status = transition.To
 	return nil
 }
+
+func (r *OrderRepository) ListStatusTransitions(orderID int64) ([]entity.StatusTransition, error) {
+	dbindex := r.router.GetShard(orderID)
+	db := r.dbShards[dbindex]
+	return readStatusTransitions(db, []int64{orderID})
+}
+
+func insertStatusTransition(tx *sql.Tx, transition *entity.StatusTransition) error {
+	if transition.CreatedAt.IsZero() {
+		transition.CreatedAt = time.Now().UTC()
+	}
+	query := `INSERT INTO order_status_transitions(order_id, from_status, to_status, actor, reason, created_at)VALUES(?, ?, ?, ?, ?, ?)`
+	_, err := tx.Exec(query, transition.OrderID, transition.From, transition.To, transition.Actor, transition.Reason, transition.CreatedAt)
+	return err
+}
+
+// checkStatusUpdated turns a compare-and-set status update that matched no
+// row into entity.ErrStatusChanged.
+func checkStatusUpdated(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return entity.ErrStatusChanged
+	}
+	return nil
+}
+
+func checkVersionUpdated(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return entity.ErrVersionMismatch
+	}
+	return nil
+}
+
+func scanOrder(row rowScanner) (*entity.OrderEntity, error) {
+	order := &entity.OrderEntity{}
+	var total, totalMarkUp, totalDiscount, baseTotal amount
+	var fxRateAt sql.NullTime
+	var couponCodes string
+	var totalTax amount
+	err := row.Scan(&order.ID, &order.UserID, &order.OrderID, &order.Quantity, &total, &order.Status, &totalMarkUp, &totalDiscount, &order.CreatedAt,
+		&order.PriceFallback, &order.QuoteID, &order.Currency, &order.FXRate.From, &order.FXRate.Rate, &fxRateAt, &baseTotal, &couponCodes,
+		&order.ShippingRegion, &totalTax, &order.Version)
+	if err != nil {
+		return nil, err
+	}
+	if couponCodes != "" {
+		order.CouponCodes = strings.Split(couponCodes, ",")
+	}
+	order.FXRate.To = order.Currency
+	order.FXRate.AsOf = fxRateAt.Time
+	if order.Total, err = total.money(order.Currency); err != nil {
+		return nil, err
+	}
+	if order.TotalMarkUp, err = totalMarkUp.money(order.Currency); err != nil {
+		return nil, err
+	}
+	if order.TotalDiscount, err = totalDiscount.money(order.Currency); err != nil {
+		return nil, err
+	}
+	if order.BaseTotal, err = baseTotal.money(order.FXRate.From); err != nil {
+		return nil, err
+	}
+	if order.TotalTax, err = totalTax.money(order.Currency); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// insertProductRequests batch inserts the product requests of an order.
+func insertProductRequests(tx *sql.Tx, orderID int64, productRequests []entity.ProductRequest) error {
+	if len(productRequests) == 0 {
+		return nil
+	}
+	productQuery := `INSERT INTO product_requests(order_id, product_id, quantity, mark_up, discount, final_price, promo_discount, promotions,
+		tax_category, tax, tax_rate, tax_inclusive)VALUES `
+	var values []interface{}
+	for _, product := range productRequests {
+		var promotions []byte
+		if len(product.Promotions) > 0 {
+			var err error
+			if promotions, err = json.Marshal(product.Promotions); err != nil {
+				return err
+			}
+		}
+		productQuery += "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?),"
+		values = append(values, orderID, product.ProductID, product.Quantity, product.MarkUp, product.Discount, product.FinalPrice, product.PromoDiscount, promotions,
+			product.TaxCategory, product.Tax, product.TaxRate, product.TaxInclusive)
+	}
+
+	// remove the trailing comma
+	productQuery = productQuery[:len(productQuery)-1]
+
+	_, err := tx.Exec(productQuery, values...)
+	return err
+}
+
+// ListUnpaidOrderIDs returns up to limit orders of a shard that are still
+// waiting for payment and were created before the given time, oldest first.
+func (r *OrderRepository) ListUnpaidOrderIDs(shard int, createdBefore time.Time, limit int) ([]int64, error) {
+	query := `SELECT order_id FROM orders WHERE status IN (?, ?) AND created_at < ? ORDER BY created_at LIMIT ?`
+	rows, err := r.dbShards[shard].Query(query, entity.StatusPending, entity.StatusAwaitingPayment, createdBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orderIDs []int64
+	for rows.Next() {
+		var orderID int64
+		if err := rows.Scan(&orderID); err != nil {
+			return nil, err
+		}
+		// skip copies of orders owned by another shard
+		if r.router.GetShard(orderID) != shard {
+			continue
+		}
+		orderIDs = append(orderIDs, orderID)
+	}
+	return orderIDs, rows.Err()
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"order-service/internal/entity"
+	"time"
+)
+
+// insertOutboxMessage queues an order event in the transaction that changes
+// the order, so the event is published if and only if the change commits.
+func insertOutboxMessage(tx *sql.Tx, order *entity.OrderEntity, eventType string) error {
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+	return insertOutboxPayload(tx, order.OrderID, eventType, payload)
+}
+
+// insertOutboxPayload queues an event whose payload is not just the order.
+func insertOutboxPayload(tx *sql.Tx, orderID int64, eventType string, payload []byte) error {
+	now := time.Now().UTC()
+	query := `INSERT INTO order_outbox(order_id, event_type, payload, next_attempt_at, created_at)VALUES(?, ?, ?, ?, ?)`
+	_, err := tx.Exec(query, orderID, eventType, payload, now, now)
+	return err
+}
+
+// PendingOutboxMessages returns up to limit unsent messages of a shard that
+// are due, in the order they were written. Only the oldest unsent message
+// of an order is returned, so messages waiting for a retry neither hold
+// back other orders nor let later messages of their order overtake them.
+func (r *OrderRepository) PendingOutboxMessages(shard, limit int) ([]entity.OutboxMessage, error) {
+	db := r.dbShards[shard]
+	query := `SELECT id, order_id, event_type, payload, attempts, next_attempt_at, created_at FROM order_outbox o
+		WHERE sent_at IS NULL AND next_attempt_at <= ?
+		AND NOT EXISTS (SELECT 1 FROM order_outbox p WHERE p.order_id = o.order_id AND p.sent_at IS NULL AND p.id < o.id)
+		ORDER BY id LIMIT ?`
+	rows, err := db.Query(query, time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []entity.OutboxMessage
+	for rows.Next() {
+		m := entity.OutboxMessage{}
+		if err := rows.Scan(&m.ID, &m.OrderID, &m.EventType, &m.Payload, &m.Attempts, &m.NextAttemptAt, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func (r *OrderRepository) MarkOutboxSent(shard int, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders, args := inClause(ids)
+	query := `UPDATE order_outbox SET sent_at = ? WHERE id IN (` + placeholders + `)`
+	_, err := r.dbShards[shard].Exec(query, append([]interface{}{time.Now().UTC()}, args...)...)
+	return err
+}
+
+// MarkOutboxFailed records a failed publish and when to try again.
+func (r *OrderRepository) MarkOutboxFailed(shard int, id int64, publishErr error, nextAttemptAt time.Time) error {
+	lastError := publishErr.Error()
+	if len(lastError) > 512 {
+		lastError = lastError[:512]
+	}
+	query := `UPDATE order_outbox SET attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?`
+	_, err := r.dbShards[shard].Exec(query, lastError, nextAttemptAt, id)
+	return err
+}
+
+func (r *OrderRepository) ShardCount() int {
+	return len(r.dbShards)
+}
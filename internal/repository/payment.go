@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"database/sql"
+	"order-service/internal/entity"
+	"time"
+)
+
+// ApplyPaymentEvent records a payment event as processed and, when
+// transition is not nil, applies the transition in the same database
+// transaction. It returns false without changing anything when the event
+// was already processed.
+func (r *OrderRepository) ApplyPaymentEvent(order *entity.OrderEntity, event entity.PaymentEvent, transition *entity.StatusTransition) (bool, error) {
+	db, err := r.writeDB(order.OrderID)
+	if err != nil {
+		return false, err
+	}
+	// start transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	outcome := "ignored"
+	if transition != nil {
+		outcome = "applied"
+	}
+	inserted, err := insertPaymentEvent(tx, entity.ProcessedPaymentEvent{
+		EventID:     event.EventID,
+		OrderID:     order.OrderID,
+		Type:        event.Type,
+		Outcome:     outcome,
+		ProcessedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if !inserted {
+		tx.Rollback()
+		return false, nil
+	}
+	if transition != nil {
+		if err := r.updateStatus(tx, order, transition); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	r.replicate(order.OrderID)
+	return true, nil
+}
+
+// insertPaymentEvent returns false when the event is already recorded.
+func insertPaymentEvent(tx *sql.Tx, event entity.ProcessedPaymentEvent) (bool, error) {
+	query := `INSERT IGNORE INTO payment_events(event_id, order_id, type, outcome, processed_at)VALUES(?, ?, ?, ?, ?)`
+	res, err := tx.Exec(query, event.EventID, event.OrderID, event.Type, event.Outcome, event.ProcessedAt)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func readPaymentEvents(db *sql.DB, orderIDs []int64) ([]entity.ProcessedPaymentEvent, error) {
+	placeholders, args := inClause(orderIDs)
+	query := `SELECT event_id, order_id, type, outcome, processed_at FROM payment_events WHERE order_id IN (` + placeholders + `)`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []entity.ProcessedPaymentEvent
+	for rows.Next() {
+		e := entity.ProcessedPaymentEvent{}
+		if err := rows.Scan(&e.EventID, &e.OrderID, &e.Type, &e.Outcome, &e.ProcessedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
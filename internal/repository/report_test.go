@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"database/sql"
+	"order-service/internal/entity"
+	"order-service/internal/sharding"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var salesColumns = []string{"slot", "currency", "base_currency", "count", "total", "base_total"}
+
+// expectSales expects the sales query of one shard, with the counted
+// statuses and the refunded returns, and answers it with rows.
+func expectSales(mock sqlmock.Sqlmock, from, to time.Time, rows *sqlmock.Rows) {
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM order_returns WHERE status = ?`)+`.*`+regexp.QuoteMeta(`o.status IN (?, ?, ?, ?, ?)`)).
+		WithArgs("refunded", from, to, "paid", "fulfilling", "shipped", "delivered", "partially_refunded").
+		WillReturnRows(rows)
+}
+
+func newMockShards(t *testing.T, n int) ([]*sql.DB, []sqlmock.Sqlmock) {
+	t.Helper()
+	dbs := make([]*sql.DB, n)
+	mocks := make([]sqlmock.Sqlmock, n)
+	for i := range dbs {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		dbs[i], mocks[i] = db, mock
+	}
+	return dbs, mocks
+}
+
+func TestSalesByCurrencyMergesShardsNetOfRefunds(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	dbs, mocks := newMockShards(t, 2)
+	repo := NewOrderRepository(dbs, sharding.NewShardRouter(sharding.NewModuloStrategy(2)))
+
+	// slot 3 belongs to shard 1; its rows left on shard 0 are not counted
+	expectSales(mocks[0], from, to, sqlmock.NewRows(salesColumns).
+		AddRow(0, "IDR", "IDR", 2, "150000.0000", "150000.0000").
+		AddRow(2, "USD", "IDR", 1, "7.5000", "120000.00000000").
+		AddRow(3, "USD", "IDR", 9, "999.0000", "999.0000"))
+	expectSales(mocks[1], from, to, sqlmock.NewRows(salesColumns).
+		AddRow(1, "IDR", "IDR", 1, "50000.0000", "50000.0000").
+		AddRow(3, "USD", "IDR", 1, "2.4950", "39920.12345678"))
+
+	totals, err := repo.SalesByCurrency(from, to)
+	if err != nil {
+		t.Fatalf("SalesByCurrency: %v", err)
+	}
+	want := []entity.CurrencyTotal{
+		{Currency: "IDR", Orders: 3, Total: entity.NewMoney(20000000, "IDR"), BaseTotal: entity.NewMoney(20000000, "IDR")},
+		{Currency: "USD", Orders: 2, Total: entity.NewMoney(1000, "USD"), BaseTotal: entity.NewMoney(15992012, "IDR")},
+	}
+	if !reflect.DeepEqual(totals, want) {
+		t.Fatalf("totals = %+v, want %+v", totals, want)
+	}
+	for i, mock := range mocks {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("shard %d: %v", i, err)
+		}
+	}
+}
+
+func TestSalesByCurrencyFailsWithAShard(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	dbs, mocks := newMockShards(t, 2)
+	repo := NewOrderRepository(dbs, sharding.NewShardRouter(sharding.NewModuloStrategy(2)))
+
+	expectSales(mocks[0], from, to, sqlmock.NewRows(salesColumns))
+	mocks[1].ExpectQuery(`FROM orders`).WillReturnError(sql.ErrConnDone)
+
+	if _, err := repo.SalesByCurrency(from, to); err == nil {
+		t.Fatal("SalesByCurrency succeeded with a shard down")
+	}
+}
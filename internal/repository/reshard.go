@@ -0,0 +1,411 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"order-service/internal/entity"
+	"order-service/internal/idgen"
+	"strings"
+)
+
+// SlotChecksum summarises the rows of one shard slot so the copy on another
+// shard can be compared without transferring the rows.
+type SlotChecksum struct {
+	Orders          int64  `json:"orders"`
+	OrdersCRC       uint64 `json:"orders_crc"`
+	ProductRequests int64  `json:"product_requests"`
+	ProductsCRC     uint64 `json:"product_requests_crc"`
+}
+
+// replicate copies an order to the shard its slot is being moved to, if
+// any. Replication errors are logged rather than returned because the
+// write on the owning shard has already committed; resharding verification
+// finds and recopies slots that drifted.
+func (r *OrderRepository) replicate(orderID int64) {
+	dst, ok := r.router.DualWriteShard(orderID)
+	if !ok {
+		return
+	}
+	src := r.dbShards[r.router.GetShard(orderID)]
+	orders, err := r.readOrders(src, `SELECT `+orderColumns+` FROM orders WHERE order_id = ?`, orderID)
+	if err == nil {
+		err = copyOrders(src, r.dbShards[dst], orders)
+	}
+	if err != nil {
+		logger.Error().Err(err).Msgf("error replicating order %d to shard %d", orderID, dst)
+	}
+}
+
+// replicateDelete removes a deleted order from the shard its slot is being
+// moved to and appends the audit events it is missing there, which
+// include the deletion.
+func (r *OrderRepository) replicateDelete(orderID int64) {
+	dst, ok := r.router.DualWriteShard(orderID)
+	if !ok {
+		return
+	}
+	src := r.dbShards[r.router.GetShard(orderID)]
+	err := deleteOrders(r.dbShards[dst], []int64{orderID})
+	if err == nil {
+		var events []entity.OrderEvent
+		if events, err = readOrderEvents(src, []int64{orderID}); err == nil {
+			err = appendOrderEvents(r.dbShards[dst], events)
+		}
+	}
+	if err != nil {
+		logger.Error().Err(err).Msgf("error replicating delete of order %d to shard %d", orderID, dst)
+	}
+}
+
+// CopySlotBatch copies up to limit orders of a slot with an order ID above
+// afterOrderID from shard src to shard dst, together with their product
+// requests and status transitions. It returns the last order ID copied and
+// how many orders were copied; zero means the slot is done.
+func (r *OrderRepository) CopySlotBatch(slot, src, dst int, afterOrderID int64, limit int) (int64, int, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE ` + idgen.SlotSQL("order_id") + ` = ? AND order_id > ? ORDER BY order_id LIMIT ?`
+	orders, err := r.readOrders(r.dbShards[src], query, slot, afterOrderID, limit)
+	if err != nil {
+		return afterOrderID, 0, err
+	}
+	if len(orders) == 0 {
+		return afterOrderID, 0, nil
+	}
+	if err := copyOrders(r.dbShards[src], r.dbShards[dst], orders); err != nil {
+		return afterOrderID, 0, err
+	}
+	return orders[len(orders)-1].OrderID, len(orders), nil
+}
+
+// CopySlotEvents appends up to limit audit events of a slot with a
+// shard-local id above afterID from shard src to shard dst. Events are
+// copied by slot because the log outlives deleted orders. It returns the
+// last id copied and how many events were read; zero means the slot is
+// done. Events already on dst are skipped, so batches may be copied again.
+func (r *OrderRepository) CopySlotEvents(slot, src, dst int, afterID int64, limit int) (int64, int, error) {
+	query := `SELECT ` + orderEventColumns + ` FROM order_events WHERE ` + idgen.SlotSQL("order_id") + ` = ? AND id > ? ORDER BY id LIMIT ?`
+	events, lastID, err := queryOrderEvents(r.dbShards[src], query, slot, afterID, limit)
+	if err != nil {
+		return afterID, 0, err
+	}
+	if len(events) == 0 {
+		return afterID, 0, nil
+	}
+	if err := appendOrderEvents(r.dbShards[dst], events); err != nil {
+		return afterID, 0, err
+	}
+	return lastID, len(events), nil
+}
+
+// ChecksumSlot counts and checksums the orders and product requests of a
+// slot on one shard.
+func (r *OrderRepository) ChecksumSlot(shard, slot int) (SlotChecksum, error) {
+	db := r.dbShards[shard]
+	sum := SlotChecksum{}
+
+	orderQuery := `SELECT COUNT(*), COALESCE(SUM(CRC32(CONCAT_WS('|', order_id, user_id, quantity, total, status, total_mark_up, total_discount, price_fallback, quote_id, currency, fx_rate, base_total, coupon_codes, shipping_region, total_tax, version))), 0) FROM orders WHERE ` + idgen.SlotSQL("order_id") + ` = ?`
+	if err := db.QueryRow(orderQuery, slot).Scan(&sum.Orders, &sum.OrdersCRC); err != nil {
+		return sum, err
+	}
+	productQuery := `SELECT COUNT(*), COALESCE(SUM(CRC32(CONCAT_WS('|', order_id, product_id, quantity, mark_up, discount, final_price, promo_discount, tax_category, tax))), 0) FROM product_requests WHERE ` + idgen.SlotSQL("order_id") + ` = ?`
+	if err := db.QueryRow(productQuery, slot).Scan(&sum.ProductRequests, &sum.ProductsCRC); err != nil {
+		return sum, err
+	}
+	return sum, nil
+}
+
+// DeleteSlotBatch removes up to limit orders of a slot from a shard that no
+// longer owns it, then, once they are gone, up to limit of the slot's
+// audit events, and returns how many rows were removed.
+func (r *OrderRepository) DeleteSlotBatch(shard, slot, limit int) (int, error) {
+	if r.router.ShardForSlot(slot) == shard {
+		return 0, fmt.Errorf("shard %d still owns slot %d", shard, slot)
+	}
+	db := r.dbShards[shard]
+	query := `SELECT order_id FROM orders WHERE ` + idgen.SlotSQL("order_id") + ` = ? ORDER BY order_id LIMIT ?`
+	rows, err := db.Query(query, slot, limit)
+	if err != nil {
+		return 0, err
+	}
+	var orderIDs []int64
+	for rows.Next() {
+		var orderID int64
+		if err := rows.Scan(&orderID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orderIDs = append(orderIDs, orderID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(orderIDs) == 0 {
+		res, err := db.Exec(`DELETE FROM order_events WHERE `+idgen.SlotSQL("order_id")+` = ? LIMIT ?`, slot, limit)
+		if err != nil {
+			return 0, err
+		}
+		deleted, err := res.RowsAffected()
+		return int(deleted), err
+	}
+	return len(orderIDs), deleteOrders(db, orderIDs)
+}
+
+func (r *OrderRepository) readOrders(db *sql.DB, query string, args ...interface{}) ([]*entity.OrderEntity, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*entity.OrderEntity
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.loadProductRequests(db, orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// copyOrders upserts orders, which must have their product requests
+// loaded, into dst and replaces their product requests, status
+// transitions, line changes, processed payment events, checkout sagas and
+// returns there. Audit events are append-only: the ones dst is missing are
+// added, none are removed. Orders already stored in dst with a newer
+// version are left alone, so a late copy never undoes a write made on dst
+// after the cutover. The shard-local auto-increment id is not copied.
+func copyOrders(src, dst *sql.DB, orders []*entity.OrderEntity) error {
+	tx, err := dst.Begin()
+	if err != nil {
+		return err
+	}
+	orders, err = staleOrders(tx, orders)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if len(orders) == 0 {
+		return tx.Commit()
+	}
+
+	orderIDs := make([]int64, 0, len(orders))
+	for _, order := range orders {
+		orderIDs = append(orderIDs, order.OrderID)
+	}
+	transitions, err := readStatusTransitions(src, orderIDs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	lineChanges, err := readLineChanges(src, orderIDs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	paymentEvents, err := readPaymentEvents(src, orderIDs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	placeholders, args := inClause(orderIDs)
+	sagas, err := readCheckoutSagas(src, `SELECT `+sagaColumns+` FROM checkout_sagas WHERE order_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	returns, err := readReturns(src, orderIDs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	events, err := readOrderEvents(src, orderIDs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	orderQuery := `INSERT INTO orders(user_id, order_id, quantity, total, status, total_mark_up, total_discount, created_at, price_fallback, quote_id,
+		currency, base_currency, fx_rate, fx_rate_at, base_total, coupon_codes, shipping_region, total_tax, version)VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), quantity = VALUES(quantity), total = VALUES(total), status = VALUES(status),
+		total_mark_up = VALUES(total_mark_up), total_discount = VALUES(total_discount), created_at = VALUES(created_at), price_fallback = VALUES(price_fallback),
+		quote_id = VALUES(quote_id), currency = VALUES(currency), base_currency = VALUES(base_currency), fx_rate = VALUES(fx_rate),
+		fx_rate_at = VALUES(fx_rate_at), base_total = VALUES(base_total), coupon_codes = VALUES(coupon_codes),
+		shipping_region = VALUES(shipping_region), total_tax = VALUES(total_tax), version = VALUES(version)`
+	for _, order := range orders {
+		_, err := tx.Exec(orderQuery, order.UserID, order.OrderID, order.Quantity, order.Total, order.Status, order.TotalMarkUp, order.TotalDiscount, order.CreatedAt, order.PriceFallback, order.QuoteID,
+			order.Currency, order.FXRate.From, order.FXRate.Rate, nullTime(order.FXRate.AsOf), order.BaseTotal, strings.Join(order.CouponCodes, ","),
+			order.ShippingRegion, order.TotalTax, order.Version)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := deleteChildRows(tx, orderIDs); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, order := range orders {
+		if err := insertProductRequests(tx, order.OrderID, order.ProductRequests); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for i := range transitions {
+		if err := insertStatusTransition(tx, &transitions[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for i := range lineChanges {
+		if err := insertLineChange(tx, &lineChanges[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, event := range paymentEvents {
+		if _, err := insertPaymentEvent(tx, event); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, saga := range sagas {
+		if err := insertCheckoutSaga(tx, saga); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, ret := range returns {
+		if err := insertReturn(tx, ret); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for i := range events {
+		if err := insertOrderEvent(tx, &events[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// staleOrders locks the dst rows of orders until tx ends and returns the
+// orders dst has no newer version of.
+func staleOrders(tx *sql.Tx, orders []*entity.OrderEntity) ([]*entity.OrderEntity, error) {
+	orderIDs := make([]int64, 0, len(orders))
+	for _, order := range orders {
+		orderIDs = append(orderIDs, order.OrderID)
+	}
+	placeholders, args := inClause(orderIDs)
+	rows, err := tx.Query(`SELECT order_id, version FROM orders WHERE order_id IN (`+placeholders+`) FOR UPDATE`, args...)
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[int64]int64)
+	for rows.Next() {
+		var orderID, version int64
+		if err := rows.Scan(&orderID, &version); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		versions[orderID] = version
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stale := orders[:0:0]
+	for _, order := range orders {
+		if version, ok := versions[order.OrderID]; ok && version > order.Version {
+			logger.Info().Msgf("skipping copy of order %d: destination has version %d, source %d", order.OrderID, version, order.Version)
+			continue
+		}
+		stale = append(stale, order)
+	}
+	return stale, nil
+}
+
+func deleteOrders(db *sql.DB, orderIDs []int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := deleteChildRows(tx, orderIDs); err != nil {
+		tx.Rollback()
+		return err
+	}
+	placeholders, args := inClause(orderIDs)
+	if _, err := tx.Exec(`DELETE FROM orders WHERE order_id IN (`+placeholders+`)`, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// appendOrderEvents adds the events db is missing in one transaction.
+func appendOrderEvents(db *sql.DB, events []entity.OrderEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		if err := insertOrderEvent(tx, &events[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// deleteChildRows removes the rows that hang off the given orders. Their
+// audit events stay: the log outlives the order.
+func deleteChildRows(tx *sql.Tx, orderIDs []int64) error {
+	placeholders, args := inClause(orderIDs)
+	for _, table := range []string{"product_requests", "order_status_transitions", "order_line_changes", "payment_events", "checkout_sagas", "order_returns"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE order_id IN (`+placeholders+`)`, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readStatusTransitions(db *sql.DB, orderIDs []int64) ([]entity.StatusTransition, error) {
+	placeholders, args := inClause(orderIDs)
+	query := `SELECT order_id, from_status, to_status, actor, reason, created_at FROM order_status_transitions WHERE order_id IN (` + placeholders + `) ORDER BY id`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transitions []entity.StatusTransition
+	for rows.Next() {
+		t := entity.StatusTransition{}
+		if err := rows.Scan(&t.OrderID, &t.From, &t.To, &t.Actor, &t.Reason, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions, rows.Err()
+}
+
+func inClause(ids []int64) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return strings.Join(placeholders, ", "), args
+}
@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"order-service/internal/entity"
+	"time"
+)
+
+const returnColumns = `return_id, order_id, line_index, product_id, quantity, reason, status, refund_amount, refund_mark_up, refund_discount, refund_tax,
+	actor, reviewer, note, created_at, updated_at`
+
+// returnEvent is the payload of the "refund_requested" and "refunded"
+// events: the order and the return the event is about.
+type returnEvent struct {
+	*entity.OrderEntity
+	Return *entity.ReturnRequest `json:"return"`
+}
+
+// CreateReturn stores a new return request. The order row is locked while
+// the quantities already being returned from the line are added up, so
+// concurrent requests cannot return more than lineQuantity units between
+// them; going over returns an error wrapping entity.ErrReturnNotAllowed.
+func (r *OrderRepository) CreateReturn(ret *entity.ReturnRequest, lineQuantity int) error {
+	db, err := r.writeDB(ret.OrderID)
+	if err != nil {
+		return err
+	}
+	// start transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var status entity.OrderStatus
+	if err := tx.QueryRow(`SELECT status FROM orders WHERE order_id = ? FOR UPDATE`, ret.OrderID).Scan(&status); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return entity.ErrOrderNotFound
+		}
+		return err
+	}
+	if !status.IsReturnable() {
+		tx.Rollback()
+		return fmt.Errorf("%w: order is %s", entity.ErrReturnNotAllowed, status)
+	}
+	var returned int
+	query := `SELECT COALESCE(SUM(quantity), 0) FROM order_returns WHERE order_id = ? AND line_index = ? AND status <> ?`
+	if err := tx.QueryRow(query, ret.OrderID, ret.LineIndex, entity.ReturnRejected).Scan(&returned); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if returned+ret.Quantity > lineQuantity {
+		tx.Rollback()
+		return fmt.Errorf("%w: %d of %d units of line %d are already being returned", entity.ErrReturnNotAllowed, returned, lineQuantity, ret.LineIndex)
+	}
+
+	now := time.Now().UTC()
+	ret.CreatedAt = now
+	ret.UpdatedAt = now
+	if err := insertReturn(tx, ret); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := auditReturn(tx, ret, ret.Actor, "return_requested", nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	r.replicate(ret.OrderID)
+	return nil
+}
+
+func (r *OrderRepository) ListReturns(orderID int64) ([]*entity.ReturnRequest, error) {
+	dbindex := r.router.GetShard(orderID)
+	db := r.dbShards[dbindex]
+	return readReturns(db, []int64{orderID})
+}
+
+// ReviewReturn saves a return that moved on from status from, records its
+// Reviewer in the audit log, and queues an event of eventType about it
+// unless eventType is empty. It returns an error wrapping
+// entity.ErrReturnNotAllowed when the stored return is no longer in status
+// from.
+func (r *OrderRepository) ReviewReturn(order *entity.OrderEntity, ret *entity.ReturnRequest, from entity.ReturnStatus, eventType string) error {
+	db, err := r.writeDB(order.OrderID)
+	if err != nil {
+		return err
+	}
+	// start transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := updateReturn(tx, ret, from, ret.Reviewer); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if eventType != "" {
+		if err := insertReturnEvent(tx, order, ret, eventType); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	r.replicate(order.OrderID)
+	return nil
+}
+
+// SettleReturn marks an approved return refunded by a payment event,
+// applies transition when it is not nil, and queues a "refunded" event
+// that also stands for the status change, all in one database transaction.
+// actor is recorded in the audit log. It returns false without changing anything
+// when the payment event was already processed.
+func (r *OrderRepository) SettleReturn(order *entity.OrderEntity, ret *entity.ReturnRequest, event entity.PaymentEvent, transition *entity.StatusTransition, actor string) (bool, error) {
+	db, err := r.writeDB(order.OrderID)
+	if err != nil {
+		return false, err
+	}
+	// start transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := insertPaymentEvent(tx, entity.ProcessedPaymentEvent{
+		EventID:     event.EventID,
+		OrderID:     order.OrderID,
+		Type:        event.Type,
+		Outcome:     "applied",
+		ProcessedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if !inserted {
+		tx.Rollback()
+		return false, nil
+	}
+	if err := updateReturn(tx, ret, entity.ReturnApproved, actor); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if transition != nil {
+		if err := r.changeStatus(tx, order, transition); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+	if err := insertReturnEvent(tx, order, ret, "refunded"); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	r.replicate(order.OrderID)
+	return true, nil
+}
+
+func insertReturnEvent(tx *sql.Tx, order *entity.OrderEntity, ret *entity.ReturnRequest, eventType string) error {
+	payload, err := json.Marshal(returnEvent{OrderEntity: order, Return: ret})
+	if err != nil {
+		return err
+	}
+	return insertOutboxPayload(tx, order.OrderID, eventType, payload)
+}
+
+func insertReturn(tx *sql.Tx, ret *entity.ReturnRequest) error {
+	query := `INSERT INTO order_returns(` + returnColumns + `)VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := tx.Exec(query, ret.ReturnID, ret.OrderID, ret.LineIndex, ret.ProductID, ret.Quantity, ret.Reason, ret.Status,
+		ret.RefundAmount, ret.RefundMarkUp, ret.RefundDiscount, ret.RefundTax, ret.Actor, ret.Reviewer, ret.Note, ret.CreatedAt, ret.UpdatedAt)
+	return err
+}
+
+// updateReturn saves a return that is still in status from and records
+// actor in the audit log.
+func updateReturn(tx *sql.Tx, ret *entity.ReturnRequest, from entity.ReturnStatus, actor string) error {
+	stored, err := readReturns(tx, []int64{ret.OrderID})
+	if err != nil {
+		return err
+	}
+	var before *entity.ReturnRequest
+	for _, r := range stored {
+		if r.ReturnID == ret.ReturnID {
+			before = r
+		}
+	}
+	ret.UpdatedAt = time.Now().UTC()
+	query := `UPDATE order_returns SET status = ?, refund_amount = ?, refund_mark_up = ?, refund_discount = ?, refund_tax = ?, reviewer = ?, note = ?, updated_at = ?
+		WHERE return_id = ? AND status = ?`
+	res, err := tx.Exec(query, ret.Status, ret.RefundAmount, ret.RefundMarkUp, ret.RefundDiscount, ret.RefundTax, ret.Reviewer, ret.Note, ret.UpdatedAt,
+		ret.ReturnID, from)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: return %d is no longer %s", entity.ErrReturnNotAllowed, ret.ReturnID, from)
+	}
+	return auditReturn(tx, ret, actor, "return_"+string(ret.Status), before)
+}
+
+// readReturns reads the returns of orders that live on db. Their amounts
+// are in the currency of their order.
+func readReturns(db querier, orderIDs []int64) ([]*entity.ReturnRequest, error) {
+	placeholders, args := inClause(orderIDs)
+	query := `SELECT ` + returnColumns + `, (SELECT currency FROM orders o WHERE o.order_id = order_returns.order_id)
+		FROM order_returns WHERE order_id IN (` + placeholders + `) ORDER BY created_at, return_id`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var returns []*entity.ReturnRequest
+	for rows.Next() {
+		ret := &entity.ReturnRequest{}
+		var refundAmount, refundMarkUp, refundDiscount, refundTax amount
+		var currency string
+		err := rows.Scan(&ret.ReturnID, &ret.OrderID, &ret.LineIndex, &ret.ProductID, &ret.Quantity, &ret.Reason, &ret.Status,
+			&refundAmount, &refundMarkUp, &refundDiscount, &refundTax, &ret.Actor, &ret.Reviewer, &ret.Note, &ret.CreatedAt, &ret.UpdatedAt, &currency)
+		if err != nil {
+			return nil, err
+		}
+		if ret.RefundAmount, err = refundAmount.money(currency); err != nil {
+			return nil, err
+		}
+		if ret.RefundMarkUp, err = refundMarkUp.money(currency); err != nil {
+			return nil, err
+		}
+		if ret.RefundDiscount, err = refundDiscount.money(currency); err != nil {
+			return nil, err
+		}
+		if ret.RefundTax, err = refundTax.money(currency); err != nil {
+			return nil, err
+		}
+		returns = append(returns, ret)
+	}
+	return returns, rows.Err()
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"order-service/internal/entity"
+	"time"
+)
+
+// SaveCheckoutSaga creates the state of a checkout saga, or replaces it if
+// it is still at saga.Version, and raises the version. It returns
+// entity.ErrSagaChanged when the saga was saved by someone else since it
+// was read, or already exists when it is created.
+func (r *OrderRepository) SaveCheckoutSaga(saga *entity.CheckoutSaga) error {
+	db, err := r.writeDB(saga.OrderID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if saga.CreatedAt.IsZero() {
+		saga.CreatedAt = now
+	}
+	saga.UpdatedAt = now
+	state, err := json.Marshal(saga.Order)
+	if err != nil {
+		return err
+	}
+
+	var res sql.Result
+	if saga.Version == 0 {
+		query := `INSERT IGNORE INTO checkout_sagas(order_id, step, status, actor, state, error, created_at, updated_at, version)VALUES(?, ?, ?, ?, ?, ?, ?, ?, 1)`
+		res, err = db.Exec(query, saga.OrderID, saga.Step, saga.Status, saga.Actor, state, sagaError(saga), saga.CreatedAt, saga.UpdatedAt)
+	} else {
+		query := `UPDATE checkout_sagas SET step = ?, status = ?, state = ?, error = ?, updated_at = ?, version = version + 1 WHERE order_id = ? AND version = ?`
+		res, err = db.Exec(query, saga.Step, saga.Status, state, sagaError(saga), saga.UpdatedAt, saga.OrderID, saga.Version)
+	}
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return entity.ErrSagaChanged
+	}
+	saga.Version++
+	return nil
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertCheckoutSaga upserts a saga as it is, timestamps and version
+// included.
+func insertCheckoutSaga(db execer, saga *entity.CheckoutSaga) error {
+	state, err := json.Marshal(saga.Order)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO checkout_sagas(order_id, step, status, actor, state, error, created_at, updated_at, version)VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE step = VALUES(step), status = VALUES(status), state = VALUES(state), error = VALUES(error), updated_at = VALUES(updated_at),
+		version = VALUES(version)`
+	_, err = db.Exec(query, saga.OrderID, saga.Step, saga.Status, saga.Actor, state, sagaError(saga), saga.CreatedAt, saga.UpdatedAt, saga.Version)
+	return err
+}
+
+// sagaError truncates the error of a saga to its column.
+func sagaError(saga *entity.CheckoutSaga) string {
+	if len(saga.Error) > 512 {
+		return saga.Error[:512]
+	}
+	return saga.Error
+}
+
+func (r *OrderRepository) GetCheckoutSaga(orderID int64) (*entity.CheckoutSaga, error) {
+	dbindex := r.router.GetShard(orderID)
+	db := r.dbShards[dbindex]
+	sagas, err := readCheckoutSagas(db, `SELECT `+sagaColumns+` FROM checkout_sagas WHERE order_id = ?`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sagas) == 0 {
+		return nil, entity.ErrSagaNotFound
+	}
+	return sagas[0], nil
+}
+
+// ListStaleCheckoutSagas returns up to limit sagas of a shard that are
+// still running or compensating and were last saved before the given time,
+// oldest first.
+func (r *OrderRepository) ListStaleCheckoutSagas(shard int, updatedBefore time.Time, limit int) ([]*entity.CheckoutSaga, error) {
+	query := `SELECT ` + sagaColumns + ` FROM checkout_sagas WHERE status IN (?, ?) AND updated_at < ? ORDER BY updated_at LIMIT ?`
+	sagas, err := readCheckoutSagas(r.dbShards[shard], query, entity.SagaRunning, entity.SagaCompensating, updatedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	// skip copies of sagas owned by another shard
+	owned := sagas[:0]
+	for _, saga := range sagas {
+		if r.router.GetShard(saga.OrderID) == shard {
+			owned = append(owned, saga)
+		}
+	}
+	return owned, nil
+}
+
+const sagaColumns = `order_id, step, status, actor, state, error, created_at, updated_at, version`
+
+func readCheckoutSagas(db *sql.DB, query string, args ...interface{}) ([]*entity.CheckoutSaga, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sagas []*entity.CheckoutSaga
+	for rows.Next() {
+		saga := &entity.CheckoutSaga{}
+		var state []byte
+		if err := rows.Scan(&saga.OrderID, &saga.Step, &saga.Status, &saga.Actor, &state, &saga.Error, &saga.CreatedAt, &saga.UpdatedAt, &saga.Version); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(state, &saga.Order); err != nil {
+			return nil, fmt.Errorf("invalid state of checkout saga %d: %w", saga.OrderID, err)
+		}
+		sagas = append(sagas, saga)
+	}
+	return sagas, rows.Err()
+}
@@ -0,0 +1,464 @@
+// Package reservation holds stock for orders in Redis so concurrent buyers
+// cannot both take the last units of a product.
+//
+// For every product Redis keeps the stock last read from the product
+// service (stock:available:<id>, refreshed when it expires), the units
+// held by open reservations (stock:reserved:<id>) and the units recently
+// sold (stock:unconfirmed:<id>, with one entry per sale in
+// stock:unconfirmed-until:<id>). A reservation succeeds only if available -
+// reserved - unconfirmed covers the requested quantity for every line,
+// checked and applied in one Lua script. The product service deducts sold
+// units asynchronously, so a snapshot read right after a sale may still
+// count them; sold units are held back for unconfirmedTTL, by which time
+// every snapshot includes their deduction.
+package reservation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"order-service/internal/entity"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog"
+)
+
+var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+const (
+	expiryKey = "reservations:expiry"
+	// snapshotTTL bounds how stale the product service stock may get.
+	snapshotTTL = 30 * time.Second
+	// releasedTTL keeps finished reservations visible to the admin API.
+	releasedTTL = 24 * time.Hour
+	// unconfirmedTTL is how long sold units are held back: the time the
+	// product service may take to deduct them plus snapshotTTL.
+	unconfirmedTTL = 5*time.Minute + snapshotTTL
+)
+
+// StockFunc reads the current stock of a product from the product service.
+type StockFunc func(ctx context.Context, productID int) (int, error)
+
+// pruneUnconfirmed defines prune(counter, entries, now), which takes the
+// units of the sales in entries that are held back no longer off counter.
+const pruneUnconfirmed = `
+local function prune(counter, entries, now)
+	local expired = redis.call("ZRANGEBYSCORE", entries, "-inf", now)
+	for _, entry in ipairs(expired) do
+		redis.call("DECRBY", counter, string.match(entry, ":(%d+)$"))
+	end
+	if #expired > 0 then
+		redis.call("ZREMRANGEBYSCORE", entries, "-inf", now)
+	end
+end
+`
+
+// reserveScript
+// KEYS: reservation, expiry set, then available, reserved, unconfirmed and
+// unconfirmed entries key per line
+// ARGV: order id, expires at (unix ms), lines json, now (unix ms), then
+// quantity per line
+// returns 1 when reserved, 2 when the order already holds an open reservation,
+// 0 with the line index when stock is short and -1 with the line index when
+// a stock snapshot is missing.
+var reserveScript = redis.NewScript(pruneUnconfirmed + `
+if redis.call("HGET", KEYS[1], "status") == "reserved" then
+	return {2, 0}
+end
+local n = (#KEYS - 2) / 4
+for i = 1, n do
+	local available = redis.call("GET", KEYS[4 * i - 1])
+	if not available then
+		return {-1, i}
+	end
+	prune(KEYS[4 * i + 1], KEYS[4 * i + 2], ARGV[4])
+	local reserved = tonumber(redis.call("GET", KEYS[4 * i]) or "0")
+	local unconfirmed = tonumber(redis.call("GET", KEYS[4 * i + 1]) or "0")
+	if tonumber(available) - reserved - unconfirmed < tonumber(ARGV[4 + i]) then
+		return {0, i}
+	end
+end
+for i = 1, n do
+	redis.call("INCRBY", KEYS[4 * i], ARGV[4 + i])
+end
+redis.call("HSET", KEYS[1], "status", "reserved", "expires_at", ARGV[2], "lines", ARGV[3])
+redis.call("PERSIST", KEYS[1])
+redis.call("ZADD", KEYS[2], ARGV[2], ARGV[1])
+return {1, 0}
+`)
+
+// finishScript closes an open reservation and gives its units back.
+// KEYS: reservation, expiry set, then available, reserved, unconfirmed and
+// unconfirmed entries key per line
+// ARGV: order id, new status, released ttl (s), convert flag, unconfirmed
+// until (unix ms), then quantity per line
+// When converting, the units are held back as unconfirmed until the given
+// time. Both unconfirmed keys expire with their last entry.
+var finishScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "status") ~= "reserved" then
+	return 0
+end
+local n = (#KEYS - 2) / 4
+for i = 1, n do
+	redis.call("DECRBY", KEYS[4 * i], ARGV[5 + i])
+	if ARGV[4] == "1" then
+		redis.call("INCRBY", KEYS[4 * i + 1], ARGV[5 + i])
+		redis.call("ZADD", KEYS[4 * i + 2], ARGV[5], ARGV[1] .. ":" .. ARGV[5 + i])
+		redis.call("PEXPIREAT", KEYS[4 * i + 1], ARGV[5])
+		redis.call("PEXPIREAT", KEYS[4 * i + 2], ARGV[5])
+	end
+end
+redis.call("HSET", KEYS[1], "status", ARGV[2])
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+redis.call("ZREM", KEYS[2], ARGV[1])
+return 1
+`)
+
+// unconfirmedScript returns the units of a product still held back.
+// KEYS: unconfirmed, unconfirmed entries
+// ARGV: now (unix ms)
+var unconfirmedScript = redis.NewScript(pruneUnconfirmed + `
+prune(KEYS[1], KEYS[2], ARGV[1])
+return tonumber(redis.call("GET", KEYS[1]) or "0")
+`)
+
+// reduceScript gives back part of the units of an open reservation.
+// KEYS: reservation, then reserved key per reduced product
+// ARGV: lines json the reservation must still have, new lines json, then
+// released quantity per reduced product
+// returns 1 when reduced, 0 when the reservation is not open and -1 when
+// its lines changed since they were read.
+var reduceScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "status") ~= "reserved" then
+	return 0
+end
+if redis.call("HGET", KEYS[1], "lines") ~= ARGV[1] then
+	return -1
+end
+for i = 2, #KEYS do
+	redis.call("DECRBY", KEYS[i], ARGV[1 + i])
+end
+redis.call("HSET", KEYS[1], "lines", ARGV[2])
+return 1
+`)
+
+type Store struct {
+	rdb   *redis.Client
+	stock StockFunc
+	ttl   time.Duration
+}
+
+func NewStore(rdb *redis.Client, stock StockFunc, ttl time.Duration) *Store {
+	return &Store{
+		rdb:   rdb,
+		stock: stock,
+		ttl:   ttl,
+	}
+}
+
+func reservationKey(orderID int64) string {
+	return fmt.Sprintf("reservation:%d", orderID)
+}
+
+func availableKey(productID int) string {
+	return fmt.Sprintf("stock:available:%d", productID)
+}
+
+func reservedKey(productID int) string {
+	return fmt.Sprintf("stock:reserved:%d", productID)
+}
+
+func unconfirmedKey(productID int) string {
+	return fmt.Sprintf("stock:unconfirmed:%d", productID)
+}
+
+func unconfirmedUntilKey(productID int) string {
+	return fmt.Sprintf("stock:unconfirmed-until:%d", productID)
+}
+
+// Reserve holds stock for every line of an order until the reservation is
+// converted, released or its TTL runs out. It returns entity.ErrOutOfStock
+// when any line cannot be covered, in which case nothing is held. Reserving
+// an order whose reservation is still open is a no-op; a finished
+// reservation is replaced.
+func (s *Store) Reserve(ctx context.Context, orderID int64, lines []entity.ReservationLine) (*entity.StockReservation, error) {
+	lines = mergeLines(lines)
+	expiresAt := time.Now().Add(s.ttl)
+	linesJSON, err := json.Marshal(lines)
+	if err != nil {
+		return nil, err
+	}
+	keys := s.lineKeys(orderID, lines)
+	args := []interface{}{orderID, expiresAt.UnixMilli(), linesJSON, time.Now().UnixMilli()}
+	for _, line := range lines {
+		args = append(args, line.Quantity)
+	}
+
+	// a missing snapshot is loaded and the script retried; one retry per
+	// line is enough since each retry fills at least one snapshot
+	for attempt := 0; attempt <= len(lines); attempt++ {
+		res, err := reserveScript.Run(ctx, s.rdb, keys, args...).Int64Slice()
+		if err != nil {
+			return nil, err
+		}
+		switch res[0] {
+		case 1, 2:
+			return s.Get(ctx, orderID)
+		case 0:
+			logger.Warn().Msgf("product %d out of stock for order %d", lines[res[1]-1].ProductID, orderID)
+			return nil, entity.ErrOutOfStock
+		}
+		if err := s.loadSnapshot(ctx, lines[res[1]-1].ProductID); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("reserve order %d: stock snapshots keep expiring", orderID)
+}
+
+// Convert turns the reservation of a paid order into a sale. Its units
+// stay unconfirmed for unconfirmedTTL.
+func (s *Store) Convert(ctx context.Context, orderID int64) error {
+	return s.finish(ctx, orderID, entity.ReservationConverted)
+}
+
+// Release gives the units of a cancelled order back.
+func (s *Store) Release(ctx context.Context, orderID int64) error {
+	return s.finish(ctx, orderID, entity.ReservationReleased)
+}
+
+// Reduce shrinks the open reservation of an order to lines, giving back the
+// units it no longer needs. Lines may only hold less than the reservation.
+// It returns entity.ErrReservationNotActive when the order holds no stock.
+func (s *Store) Reduce(ctx context.Context, orderID int64, lines []entity.ReservationLine) error {
+	lines = mergeLines(lines)
+	remaining := make(map[int]int, len(lines))
+	for _, line := range lines {
+		remaining[line.ProductID] = line.Quantity
+	}
+	linesJSON, err := json.Marshal(lines)
+	if err != nil {
+		return err
+	}
+
+	// the lines are compared in the script, so a concurrent reduction makes
+	// this one read the reservation again
+	for attempt := 0; attempt < 3; attempt++ {
+		reservation, err := s.Get(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		if reservation.Status != entity.ReservationReserved {
+			return entity.ErrReservationNotActive
+		}
+		currentJSON, err := json.Marshal(reservation.Lines)
+		if err != nil {
+			return err
+		}
+		keys := []string{reservationKey(orderID)}
+		args := []interface{}{currentJSON, linesJSON}
+		for _, line := range reservation.Lines {
+			released := line.Quantity - remaining[line.ProductID]
+			if released < 0 {
+				return fmt.Errorf("reduce order %d: product %d would grow from %d to %d", orderID, line.ProductID, line.Quantity, remaining[line.ProductID])
+			}
+			if released > 0 {
+				keys = append(keys, reservedKey(line.ProductID))
+				args = append(args, released)
+			}
+		}
+		res, err := reduceScript.Run(ctx, s.rdb, keys, args...).Int()
+		if err != nil {
+			return err
+		}
+		switch res {
+		case 1:
+			return nil
+		case 0:
+			return entity.ErrReservationNotActive
+		}
+	}
+	return fmt.Errorf("reduce order %d: reservation keeps changing", orderID)
+}
+
+func (s *Store) finish(ctx context.Context, orderID int64, status entity.ReservationStatus) error {
+	reservation, err := s.Get(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if reservation.Status != entity.ReservationReserved {
+		return entity.ErrReservationNotActive
+	}
+
+	convert := "0"
+	if status == entity.ReservationConverted {
+		convert = "1"
+	}
+	keys := s.lineKeys(orderID, reservation.Lines)
+	unconfirmedUntil := time.Now().Add(unconfirmedTTL).UnixMilli()
+	args := []interface{}{orderID, string(status), int(releasedTTL.Seconds()), convert, unconfirmedUntil}
+	for _, line := range reservation.Lines {
+		args = append(args, line.Quantity)
+	}
+	done, err := finishScript.Run(ctx, s.rdb, keys, args...).Int()
+	if err != nil {
+		return err
+	}
+	if done == 0 {
+		return entity.ErrReservationNotActive
+	}
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, orderID int64) (*entity.StockReservation, error) {
+	fields, err := s.rdb.HGetAll(ctx, reservationKey(orderID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, entity.ErrReservationNotActive
+	}
+	reservation := &entity.StockReservation{
+		OrderID: orderID,
+		Status:  entity.ReservationStatus(fields["status"]),
+	}
+	if err := json.Unmarshal([]byte(fields["lines"]), &reservation.Lines); err != nil {
+		return nil, err
+	}
+	expiresAt, err := strconv.ParseInt(fields["expires_at"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	reservation.ExpiresAt = time.UnixMilli(expiresAt).UTC()
+	return reservation, nil
+}
+
+// List returns open reservations, soonest to expire first.
+func (s *Store) List(ctx context.Context, offset, limit int) ([]*entity.StockReservation, error) {
+	members, err := s.rdb.ZRange(ctx, expiryKey, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	reservations := make([]*entity.StockReservation, 0, len(members))
+	for _, member := range members {
+		orderID, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		reservation, err := s.Get(ctx, orderID)
+		if errors.Is(err, entity.ErrReservationNotActive) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+	return reservations, nil
+}
+
+func (s *Store) StockLevel(ctx context.Context, productID int) (*entity.StockLevel, error) {
+	level := &entity.StockLevel{ProductID: productID}
+	available, err := s.rdb.Get(ctx, availableKey(productID)).Int()
+	switch {
+	case err == nil:
+		level.Available = &available
+	case !errors.Is(err, redis.Nil):
+		return nil, err
+	}
+	level.Reserved, err = s.rdb.Get(ctx, reservedKey(productID)).Int()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	keys := []string{unconfirmedKey(productID), unconfirmedUntilKey(productID)}
+	level.Unconfirmed, err = unconfirmedScript.Run(ctx, s.rdb, keys, time.Now().UnixMilli()).Int()
+	if err != nil {
+		return nil, err
+	}
+	return level, nil
+}
+
+// Sweep expires reservations whose TTL has passed and returns how many it
+// released.
+func (s *Store) Sweep(ctx context.Context) (int, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	members, err := s.rdb.ZRangeByScore(ctx, expiryKey, &redis.ZRangeBy{Min: "-inf", Max: now, Count: 100}).Result()
+	if err != nil {
+		return 0, err
+	}
+	swept := 0
+	for _, member := range members {
+		orderID, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return swept, err
+		}
+		err = s.finish(ctx, orderID, entity.ReservationExpired)
+		if errors.Is(err, entity.ErrReservationNotActive) {
+			s.rdb.ZRem(ctx, expiryKey, member)
+			continue
+		}
+		if err != nil {
+			return swept, err
+		}
+		swept++
+	}
+	return swept, nil
+}
+
+// RunSweeper sweeps expired reservations every interval until ctx is done.
+// The scripts make concurrent sweeps from several instances safe.
+func (s *Store) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			swept, err := s.Sweep(ctx)
+			if err != nil {
+				logger.Error().Err(err).Msg("error sweeping expired reservations")
+			}
+			if swept > 0 {
+				logger.Info().Msgf("released %d expired reservations", swept)
+			}
+		}
+	}
+}
+
+func (s *Store) loadSnapshot(ctx context.Context, productID int) error {
+	stock, err := s.stock(ctx, productID)
+	if err != nil {
+		return err
+	}
+	return s.rdb.SetNX(ctx, availableKey(productID), stock, snapshotTTL).Err()
+}
+
+func (s *Store) lineKeys(orderID int64, lines []entity.ReservationLine) []string {
+	keys := []string{reservationKey(orderID), expiryKey}
+	for _, line := range lines {
+		keys = append(keys, availableKey(line.ProductID), reservedKey(line.ProductID), unconfirmedKey(line.ProductID), unconfirmedUntilKey(line.ProductID))
+	}
+	return keys
+}
+
+// mergeLines sums the quantities of lines for the same product so every
+// product appears once in the scripts.
+func mergeLines(lines []entity.ReservationLine) []entity.ReservationLine {
+	quantities := make(map[int]int)
+	for _, line := range lines {
+		quantities[line.ProductID] += line.Quantity
+	}
+	merged := make([]entity.ReservationLine, 0, len(quantities))
+	for productID, quantity := range quantities {
+		merged = append(merged, entity.ReservationLine{ProductID: productID, Quantity: quantity})
+	}
+	sort.Slice(merged, func(a, b int) bool {
+		return merged[a].ProductID < merged[b].ProductID
+	})
+	return merged
+}
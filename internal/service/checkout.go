@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"order-service/internal/entity"
+	"order-service/internal/lease"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	checkoutActor     = "system:checkout"
+	checkoutBatchSize = 100
+)
+
+// PaymentRequester asks the payment service to collect or drop the payment
+// of an order. Both calls may repeat for the same order.
+type PaymentRequester interface {
+	RequestPayment(ctx context.Context, order *entity.OrderEntity) error
+	CancelPayment(ctx context.Context, order *entity.OrderEntity) error
+}
+
+// KafkaPaymentRequester publishes payment requests to a topic the payment
+// service consumes, keyed by order.
+type KafkaPaymentRequester struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaPaymentRequester(writer *kafka.Writer) *KafkaPaymentRequester {
+	return &KafkaPaymentRequester{
+		writer: writer,
+	}
+}
+
+func (k *KafkaPaymentRequester) RequestPayment(ctx context.Context, order *entity.OrderEntity) error {
+	return k.publish(ctx, order, "payment.requested")
+}
+
+func (k *KafkaPaymentRequester) CancelPayment(ctx context.Context, order *entity.OrderEntity) error {
+	return k.publish(ctx, order, "payment.cancel_requested")
+}
+
+func (k *KafkaPaymentRequester) publish(ctx context.Context, order *entity.OrderEntity, eventType string) error {
+	payload, err := json.Marshal(entity.PaymentRequest{
+		OrderID: order.OrderID,
+		UserID:  order.UserID,
+		Amount:  order.Total,
+	})
+	if err != nil {
+		return err
+	}
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(fmt.Sprintf("order-%d", order.OrderID)),
+		Value: payload,
+		Headers: []kafka.Header{
+			{Key: "event_type", Value: []byte(eventType)},
+		},
+	})
+}
+
+// NoopPaymentRequester drops payment requests, for running without Kafka.
+type NoopPaymentRequester struct{}
+
+func (NoopPaymentRequester) RequestPayment(ctx context.Context, order *entity.OrderEntity) error {
+	return nil
+}
+
+func (NoopPaymentRequester) CancelPayment(ctx context.Context, order *entity.OrderEntity) error {
+	return nil
+}
+
+// checkoutSteps are the steps of the checkout of a priced order. The saga
+// state holds the order as it was priced, so a resumed checkout charges
+// the same prices.
+func (o *OrderService) checkoutSteps() []SagaStep {
+	return []SagaStep{
+		sagaStep{name: "reserve_stock", execute: o.reserveStock, compensate: o.releaseStock},
+		sagaStep{name: "lock_price", execute: o.lockPrice, compensate: o.unlockPrice},
+		sagaStep{name: "persist_order", execute: o.persistOrder, compensate: retryStep(o.cancelPersistedOrder)},
+		sagaStep{name: "request_payment", execute: retryStep(o.requestPayment), compensate: o.cancelPayment},
+		sagaStep{name: "confirm", execute: o.confirmCheckout},
+	}
+}
+
+func (o *OrderService) reserveStock(ctx context.Context, saga *entity.CheckoutSaga) error {
+	_, err := o.reservations.Reserve(ctx, saga.OrderID, reservationLines(saga.Order))
+	return err
+}
+
+func (o *OrderService) releaseStock(ctx context.Context, saga *entity.CheckoutSaga) error {
+	err := o.reservations.Release(ctx, saga.OrderID)
+	if errors.Is(err, entity.ErrReservationNotActive) {
+		return nil
+	}
+	return err
+}
+
+// lockPrice counts the uses of the order's coupons, which fixes the
+// discounts the order was priced with.
+func (o *OrderService) lockPrice(ctx context.Context, saga *entity.CheckoutSaga) error {
+	order := saga.Order
+	if len(order.CouponCodes) == 0 {
+		return nil
+	}
+	promotions, err := o.promotions.Get(ctx, order.CouponCodes)
+	if err != nil {
+		return err
+	}
+	return o.promotions.Redeem(ctx, order.OrderID, order.UserID, promotions)
+}
+
+func (o *OrderService) unlockPrice(ctx context.Context, saga *entity.CheckoutSaga) error {
+	return o.promotions.Release(ctx, saga.OrderID, saga.Order.UserID, saga.Order.CouponCodes)
+}
+
+// persistOrder stores the order and queues its "created" event, unless a
+// previous run already did.
+func (o *OrderService) persistOrder(ctx context.Context, saga *entity.CheckoutSaga) error {
+	_, err := o.orderRepo.GetOrderByID(saga.OrderID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, entity.ErrOrderNotFound) {
+		return err
+	}
+	_, err = o.orderRepo.CreateOrder(saga.Order, saga.Actor)
+	return err
+}
+
+// cancelPersistedOrder cancels the stored order; it is kept for its
+// history rather than deleted.
+func (o *OrderService) cancelPersistedOrder(ctx context.Context, saga *entity.CheckoutSaga) error {
+	current, err := o.orderRepo.GetOrderByID(saga.OrderID)
+	if errors.Is(err, entity.ErrOrderNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !current.Status.CanTransitionTo(entity.StatusCancelled) {
+		return nil
+	}
+	err = o.orderRepo.UpdateOrderStatus(current, entity.StatusTransition{
+		OrderID: current.OrderID,
+		From:    current.Status,
+		To:      entity.StatusCancelled,
+		Actor:   checkoutActor,
+		Reason:  saga.Error,
+	})
+	if err != nil {
+		return err
+	}
+	saga.Order.Status, saga.Order.Version = current.Status, current.Version
+	return nil
+}
+
+// requestPayment moves the order to awaiting_payment before asking for the
+// payment, so a payment confirmed right away finds it there. The stored
+// order is charged: its lines may have changed while it was pending.
+func (o *OrderService) requestPayment(ctx context.Context, saga *entity.CheckoutSaga) error {
+	current, err := o.orderRepo.GetOrderByID(saga.OrderID)
+	if err != nil {
+		return err
+	}
+	switch current.Status {
+	case entity.StatusPending:
+		err := o.orderRepo.UpdateOrderStatus(current, entity.StatusTransition{
+			OrderID: current.OrderID,
+			From:    entity.StatusPending,
+			To:      entity.StatusAwaitingPayment,
+			Actor:   checkoutActor,
+			Reason:  "payment requested",
+		})
+		if err != nil {
+			return err
+		}
+	case entity.StatusAwaitingPayment:
+	default:
+		// paid, or ended, before the saga got here
+		saga.Order.Status, saga.Order.Version = current.Status, current.Version
+		return nil
+	}
+	saga.Order = current
+	return o.payments.RequestPayment(ctx, saga.Order)
+}
+
+func (o *OrderService) cancelPayment(ctx context.Context, saga *entity.CheckoutSaga) error {
+	return o.payments.CancelPayment(ctx, saga.Order)
+}
+
+// confirmCheckout waits for the payment events to settle the order. A
+// cancelled or expired order fails the step, which compensates the rest.
+func (o *OrderService) confirmCheckout(ctx context.Context, saga *entity.CheckoutSaga) error {
+	current, err := o.orderRepo.GetOrderByID(saga.OrderID)
+	if err != nil {
+		return err
+	}
+	saga.Order.Status, saga.Order.Version = current.Status, current.Version
+	switch current.Status {
+	case entity.StatusPending, entity.StatusAwaitingPayment:
+		return ErrStepPending
+	case entity.StatusCancelled, entity.StatusExpired:
+		return fmt.Errorf("order %d was %s before it was paid", saga.OrderID, current.Status)
+	}
+	return nil
+}
+
+func (o *OrderService) GetCheckout(ctx context.Context, orderID int64) (*entity.CheckoutSaga, error) {
+	return o.orderRepo.GetCheckoutSaga(orderID)
+}
+
+// resumeCheckout carries the checkout of an order on right away, instead of
+// waiting for the recovery scan, after something it waits for happened.
+func (o *OrderService) resumeCheckout(ctx context.Context, orderID int64) {
+	saga, err := o.orderRepo.GetCheckoutSaga(orderID)
+	if errors.Is(err, entity.ErrSagaNotFound) {
+		return
+	}
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error getting checkout of order %d", orderID)
+		return
+	}
+	if err := o.checkout.Run(ctx, saga); err != nil {
+		logger.Warn().Err(err).Msgf("checkout of order %d did not complete", orderID)
+	}
+}
+
+// CheckoutRecovery resumes, or finishes compensating, checkouts that were
+// not saved for a while, such as those of a stopped instance and those
+// waiting for a payment. Scans run under a Redis lease so only one
+// instance scans at a time.
+type CheckoutRecovery struct {
+	orderService *OrderService
+	lease        *lease.Lease
+	staleAfter   time.Duration
+	interval     time.Duration
+}
+
+func NewCheckoutRecovery(orderService *OrderService, rdb *redis.Client, staleAfter, interval time.Duration) *CheckoutRecovery {
+	return &CheckoutRecovery{
+		orderService: orderService,
+		lease:        lease.New(rdb, "checkout-recovery", 2*interval+10*time.Second),
+		staleAfter:   staleAfter,
+		interval:     interval,
+	}
+}
+
+// Run scans every interval until ctx is done.
+func (r *CheckoutRecovery) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.lease.Release(context.Background())
+			return
+		case <-ticker.C:
+			held, err := r.lease.Acquire(ctx)
+			if err != nil {
+				logger.Error().Err(err).Msg("error acquiring checkout recovery lease")
+				continue
+			}
+			if held {
+				r.scan(ctx)
+			}
+		}
+	}
+}
+
+func (r *CheckoutRecovery) scan(ctx context.Context) {
+	updatedBefore := time.Now().Add(-r.staleAfter).UTC()
+	repo := r.orderService.orderRepo
+	for shard := 0; shard < repo.ShardCount(); shard++ {
+		sagas, err := repo.ListStaleCheckoutSagas(shard, updatedBefore, checkoutBatchSize)
+		if err != nil {
+			logger.Error().Err(err).Msgf("error scanning shard %d for stale checkouts", shard)
+			continue
+		}
+		for _, saga := range sagas {
+			if err := r.orderService.checkout.Run(ctx, saga); err != nil {
+				logger.Warn().Err(err).Msgf("checkout of order %d did not complete", saga.OrderID)
+			}
+		}
+	}
+}
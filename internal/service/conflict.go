@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"order-service/internal/entity"
+)
+
+// conflictAttempts is how many times an internal change is tried when the
+// order keeps changing between reading and writing it.
+const conflictAttempts = 3
+
+// retryOnConflict runs fn until it does not fail because the order changed
+// concurrently, at most conflictAttempts times. fn must read the order
+// afresh every time.
+func retryOnConflict(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < conflictAttempts; attempt++ {
+		err = fn()
+		if !isConflict(err) || ctx.Err() != nil {
+			return err
+		}
+		logger.Warn().Err(err).Msgf("order changed concurrently, retrying (attempt %d)", attempt+1)
+	}
+	return err
+}
+
+func isConflict(err error) bool {
+	return errors.Is(err, entity.ErrStatusChanged) || errors.Is(err, entity.ErrVersionMismatch)
+}
+
+// retryStep makes a saga step function retry on conflicts instead of
+// failing the checkout.
+func retryStep(fn func(ctx context.Context, saga *entity.CheckoutSaga) error) func(ctx context.Context, saga *entity.CheckoutSaga) error {
+	return func(ctx context.Context, saga *entity.CheckoutSaga) error {
+		return retryOnConflict(ctx, func() error {
+			return fn(ctx, saga)
+		})
+	}
+}
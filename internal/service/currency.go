@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"order-service/internal/entity"
+	"time"
+)
+
+// exchangeRate returns the rate from the base currency, which the pricing
+// service quotes in, to currency.
+func (o *OrderService) exchangeRate(ctx context.Context, currency string) (entity.FXRate, error) {
+	rate, err := o.fx.Rate(ctx, entity.DefaultCurrency, currency)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error getting exchange rate from %s to %s", entity.DefaultCurrency, currency)
+		return entity.FXRate{}, err
+	}
+	return rate, nil
+}
+
+// convertPricing returns the unit pricing in the currency rate converts to.
+func convertPricing(pricing *entity.Pricing, rate entity.FXRate) (*entity.Pricing, error) {
+	converted := *pricing
+	var err error
+	if converted.FinalPrice, err = rate.Convert(pricing.FinalPrice, entity.RoundHalfEven); err != nil {
+		return nil, err
+	}
+	if converted.Markup, err = rate.Convert(pricing.Markup, entity.RoundHalfEven); err != nil {
+		return nil, err
+	}
+	if converted.Discount, err = rate.Convert(pricing.Discount, entity.RoundHalfEven); err != nil {
+		return nil, err
+	}
+	return &converted, nil
+}
+
+// baseAmount converts an amount of the order back into the base currency
+// with the order's rate, for reporting.
+func baseAmount(order *entity.OrderEntity, m entity.Money) (entity.Money, error) {
+	inverse, err := order.FXRate.Inverse()
+	if err != nil {
+		return entity.Money{}, err
+	}
+	return inverse.Convert(m, entity.RoundHalfEven)
+}
+
+// SalesReport sums the paid orders created in [from, to), net of refunds.
+// Every order is counted in the base currency with the rate stored when it
+// was created.
+func (o *OrderService) SalesReport(ctx context.Context, from, to time.Time) (*entity.SalesReport, error) {
+	totals, err := o.orderRepo.SalesByCurrency(from, to)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error building sales report")
+		return nil, err
+	}
+	report := &entity.SalesReport{
+		BaseCurrency: entity.DefaultCurrency,
+		From:         from,
+		To:           to,
+		Total:        entity.NewMoney(0, entity.DefaultCurrency),
+		ByCurrency:   totals,
+	}
+	for _, t := range totals {
+		report.Orders += t.Orders
+		if report.Total, err = report.Total.Add(t.BaseTotal); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"order-service/internal/entity"
+	"order-service/internal/lease"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	expiryActor     = "system:expiry"
+	expiryBatchSize = 100
+)
+
+// ExpiryScheduler expires orders that were not paid within the payment
+// deadline. Scans run under a Redis lease so only one instance scans at a
+// time; expiring goes through OrderService.TransitionOrder, which releases
+// the reserved stock and queues the "expired" event.
+type ExpiryScheduler struct {
+	orderService *OrderService
+	lease        *lease.Lease
+	deadline     time.Duration
+	interval     time.Duration
+}
+
+func NewExpiryScheduler(orderService *OrderService, rdb *redis.Client, deadline, interval time.Duration) *ExpiryScheduler {
+	return &ExpiryScheduler{
+		orderService: orderService,
+		lease:        lease.New(rdb, "order-expiry", 2*interval+10*time.Second),
+		deadline:     deadline,
+		interval:     interval,
+	}
+}
+
+// Run scans every interval until ctx is done.
+func (s *ExpiryScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.lease.Release(context.Background())
+			return
+		case <-ticker.C:
+			held, err := s.lease.Acquire(ctx)
+			if err != nil {
+				logger.Error().Err(err).Msg("error acquiring order expiry lease")
+				continue
+			}
+			if !held {
+				continue
+			}
+			expired := s.scan(ctx)
+			if expired > 0 {
+				logger.Info().Msgf("expired %d unpaid orders", expired)
+			}
+		}
+	}
+}
+
+func (s *ExpiryScheduler) scan(ctx context.Context) int {
+	expired := 0
+	createdBefore := time.Now().Add(-s.deadline).UTC()
+	repo := s.orderService.orderRepo
+	for shard := 0; shard < repo.ShardCount(); shard++ {
+		orderIDs, err := repo.ListUnpaidOrderIDs(shard, createdBefore, expiryBatchSize)
+		if err != nil {
+			logger.Error().Err(err).Msgf("error scanning shard %d for unpaid orders", shard)
+			continue
+		}
+		for _, orderID := range orderIDs {
+			_, err := s.orderService.TransitionOrder(ctx, orderID, entity.StatusExpired, expiryActor, "payment deadline passed")
+			var transitionErr *entity.TransitionError
+			switch {
+			case err == nil:
+				expired++
+			case errors.As(err, &transitionErr), errors.Is(err, entity.ErrStatusChanged):
+				// paid or cancelled while we were scanning
+			default:
+				logger.Error().Err(err).Msgf("error expiring order %d", orderID)
+			}
+		}
+	}
+	return expired
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"order-service/internal/entity"
+)
+
+// checkLineChange allows the lines of pending orders to be cancelled or
+// reduced. Once the payment was requested the amount asked for is fixed,
+// and paid lines would owe the buyer a refund, which only returns pay out.
+func checkLineChange(order *entity.OrderEntity) error {
+	switch order.Status {
+	case entity.StatusPending:
+		return nil
+	case entity.StatusAwaitingPayment:
+		return fmt.Errorf("%w: payment was requested, cancel the order instead", entity.ErrLineChangeNotAllowed)
+	case entity.StatusPaid:
+		return fmt.Errorf("%w: order is paid, request a return instead", entity.ErrLineChangeNotAllowed)
+	}
+	return fmt.Errorf("%w: order is %s", entity.ErrLineChangeNotAllowed, order.Status)
+}
+
+// CancelLine removes a line of an order. The last line cannot be removed;
+// the order is cancelled instead.
+func (o *OrderService) CancelLine(ctx context.Context, orderID int64, index int, actor, reason string) (*entity.OrderEntity, error) {
+	return o.changeLine(ctx, orderID, index, 0, actor, reason)
+}
+
+// ReduceLine lowers the quantity of a line of an order.
+func (o *OrderService) ReduceLine(ctx context.Context, orderID int64, index, quantity int, actor, reason string) (*entity.OrderEntity, error) {
+	if quantity <= 0 {
+		return nil, entity.ErrInvalidQuantity
+	}
+	return o.changeLine(ctx, orderID, index, quantity, actor, reason)
+}
+
+func (o *OrderService) ListLineChanges(ctx context.Context, orderID int64) ([]entity.LineChange, error) {
+	return o.orderRepo.ListLineChanges(orderID)
+}
+
+// changeLine sets the quantity of a line, removing it at zero, and gives the
+// stock it no longer needs back to the reservation. An order that changes
+// in the meantime is read again and checked anew.
+func (o *OrderService) changeLine(ctx context.Context, orderID int64, index, quantity int, actor, reason string) (*entity.OrderEntity, error) {
+	var order *entity.OrderEntity
+	err := retryOnConflict(ctx, func() error {
+		var err error
+		order, err = o.changeLineOnce(orderID, index, quantity, actor, reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = o.reservations.Reduce(ctx, orderID, reservationLines(order))
+	if err != nil && !errors.Is(err, entity.ErrReservationNotActive) {
+		logger.Error().Err(err).Msgf("Error releasing stock of line %d of order %d", index, orderID)
+	}
+	return order, nil
+}
+
+func (o *OrderService) changeLineOnce(orderID int64, index, quantity int, actor, reason string) (*entity.OrderEntity, error) {
+	order, err := o.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error getting order by ID %d", orderID)
+		return nil, err
+	}
+	if index < 0 || index >= len(order.ProductRequests) {
+		return nil, entity.ErrLineNotFound
+	}
+	if err := checkLineChange(order); err != nil {
+		return nil, err
+	}
+	line := &order.ProductRequests[index]
+	if quantity >= line.Quantity {
+		return nil, fmt.Errorf("%w: line %d has %d, the new quantity must be lower", entity.ErrInvalidQuantity, index, line.Quantity)
+	}
+	if quantity == 0 && len(order.ProductRequests) == 1 {
+		return nil, fmt.Errorf("%w: cannot cancel the last line, cancel the order instead", entity.ErrLineChangeNotAllowed)
+	}
+	change := &entity.LineChange{
+		OrderID:      orderID,
+		Index:        index,
+		ProductID:    line.ProductID,
+		FromQuantity: line.Quantity,
+		ToQuantity:   quantity,
+		Actor:        actor,
+		Reason:       reason,
+	}
+	if quantity == 0 {
+		order.ProductRequests = append(order.ProductRequests[:index], order.ProductRequests[index+1:]...)
+	} else {
+		if err := scaleLine(line, quantity); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := aggregateTotals(order); err != nil {
+		return nil, err
+	}
+	if order.BaseTotal, err = baseAmount(order, order.Total); err != nil {
+		return nil, err
+	}
+	if err := o.orderRepo.UpdateOrderLines(order, change); err != nil {
+		logger.Error().Err(err).Msgf("Error changing line %d of order %d", index, orderID)
+		return nil, err
+	}
+	return order, nil
+}
+
+// scaleLine sets a line to a lower quantity. Its amounts are scaled in
+// proportion, so the line keeps the prices, coupon discounts and tax rate
+// it was ordered with.
+func scaleLine(line *entity.ProductRequest, quantity int) error {
+	from, to := int64(line.Quantity), int64(quantity)
+	var err error
+	scale := func(m entity.Money) entity.Money {
+		scaled, mulErr := m.MulRat(to, from, entity.RoundHalfEven)
+		if mulErr != nil && err == nil {
+			err = mulErr
+		}
+		return scaled
+	}
+
+	// FinalPrice already has the coupon discounts taken off; the price
+	// before them is a whole number of units and scales exactly
+	gross, err := line.FinalPrice.Add(line.PromoDiscount)
+	if err != nil {
+		return err
+	}
+	gross = scale(gross)
+	if len(line.Promotions) > 0 {
+		line.PromoDiscount = entity.NewMoney(0, line.FinalPrice.Currency)
+		for i := range line.Promotions {
+			line.Promotions[i].Discount = scale(line.Promotions[i].Discount)
+			if err != nil {
+				return err
+			}
+			if line.PromoDiscount, err = line.PromoDiscount.Add(line.Promotions[i].Discount); err != nil {
+				return err
+			}
+		}
+	} else {
+		line.PromoDiscount = scale(line.PromoDiscount)
+	}
+	if err != nil {
+		return err
+	}
+	if line.FinalPrice, err = gross.Sub(line.PromoDiscount); err != nil {
+		return err
+	}
+	line.MarkUp = scale(line.MarkUp)
+	line.Discount = scale(line.Discount)
+	line.Tax = scale(line.Tax)
+	line.Quantity = quantity
+	return err
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"order-service/internal/entity"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// orderCursor is the position of the last order of a page. It is handed to
+// clients base64 encoded so they treat it as opaque.
+type orderCursor struct {
+	OrderID int64 `json:"o"`
+}
+
+func (o *OrderService) GetOrder(ctx context.Context, orderID int64) (*entity.OrderEntity, error) {
+	order, err := o.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error getting order by ID %d", orderID)
+		return nil, err
+	}
+	return order, nil
+}
+
+func (o *OrderService) ListOrders(ctx context.Context, filter entity.OrderFilter, cursor string) (*entity.OrderPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultPageSize
+	}
+	if filter.Limit > maxPageSize {
+		filter.Limit = maxPageSize
+	}
+	if cursor != "" {
+		c, err := decodeOrderCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.AfterOrderID = c.OrderID
+	}
+
+	orders, err := o.orderRepo.ListOrders(filter)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error listing orders for user %d", filter.UserID)
+		return nil, err
+	}
+
+	page := &entity.OrderPage{Orders: orders}
+	if len(orders) > filter.Limit {
+		page.Orders = orders[:filter.Limit]
+		last := page.Orders[len(page.Orders)-1]
+		page.NextCursor = encodeOrderCursor(orderCursor{OrderID: last.OrderID})
+	}
+	if page.Orders == nil {
+		page.Orders = []*entity.OrderEntity{}
+	}
+	return page, nil
+}
+
+func encodeOrderCursor(c orderCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeOrderCursor(s string) (orderCursor, error) {
+	var c orderCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, entity.ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &c); err != nil || c.OrderID <= 0 {
+		return c, entity.ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func (o *OrderService) ListStatusTransitions(ctx context.Context, orderID int64) ([]entity.StatusTransition, error) {
+	if _, err := o.orderRepo.GetOrderByID(orderID); err != nil {
+		return nil, err
+	}
+	transitions, err := o.orderRepo.ListStatusTransitions(orderID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error listing status transitions for order %d", orderID)
+		return nil, err
+	}
+	if transitions == nil {
+		transitions = []entity.StatusTransition{}
+	}
+	return transitions, nil
+}
+
+// OrderHistory returns the audit log of an order, oldest first. Deleted
+// orders keep theirs.
+func (o *OrderService) OrderHistory(ctx context.Context, orderID int64) ([]entity.OrderEvent, error) {
+	events, err := o.orderRepo.ListOrderEvents(orderID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error listing history of order %d", orderID)
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, entity.ErrOrderNotFound
+	}
+	return events, nil
+}
@@ -3,310 +3,473 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand"
-	"net/http"
+	"order-service/internal/client"
 	"order-service/internal/entity"
+	"order-service/internal/fx"
+	"order-service/internal/idgen"
+	"order-service/internal/promotion"
+	"order-service/internal/quote"
 	"order-service/internal/repository"
+	"order-service/internal/reservation"
+	"order-service/internal/sharding"
+	"order-service/internal/tax"
 	"os"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog"
 	"github.com/segmentio/kafka-go"
+	"golang.org/x/sync/errgroup"
 )
 
 var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
 
 type OrderService struct {
-	orderRepo         repository.OrderRepository
-	productServiceURL string
-	pricingServiceURL string
-	kafkaWriter       *kafka.Writer
-	rdb               *redis.Client
+	orderRepo     repository.OrderRepository
+	productClient client.ProductClient
+	pricingClient client.PricingClient
+	kafkaWriter   *kafka.Writer
+	rdb           *redis.Client
+	idGen         *idgen.Generator
+	reservations  *reservation.Store
+	quotes        *quote.Store
+	fx            fx.Provider
+	promotions    *promotion.Store
+	tax           tax.Calculator
+	payments      PaymentRequester
+	checkout      *SagaOrchestrator
 }
 
-func NewOrderService(orderRepo repository.OrderRepository, productServiceURL, pricingServiceURL string, kafkaWriter *kafka.Writer, rdb *redis.Client) *OrderService {
-	return &OrderService{
-		orderRepo:         orderRepo,
-		productServiceURL: pricingServiceURL,
-		pricingServiceURL: pricingServiceURL,
-		kafkaWriter:       kafkaWriter,
-		rdb:               rdb,
+func NewOrderService(orderRepo repository.OrderRepository, productClient client.ProductClient, pricingClient client.PricingClient, kafkaWriter *kafka.Writer, rdb *redis.Client, idGen *idgen.Generator, reservationTTL time.Duration, quotes *quote.Store, fxProvider fx.Provider, promotions *promotion.Store, taxCalculator tax.Calculator, payments PaymentRequester) *OrderService {
+	o := &OrderService{
+		orderRepo:     orderRepo,
+		productClient: productClient,
+		pricingClient: pricingClient,
+		kafkaWriter:   kafkaWriter,
+		rdb:           rdb,
+		idGen:         idGen,
+		quotes:        quotes,
+		fx:            fxProvider,
+		promotions:    promotions,
+		tax:           taxCalculator,
+		payments:      payments,
 	}
+	o.reservations = reservation.NewStore(rdb, productClient.GetStock, reservationTTL)
+	o.checkout = NewSagaOrchestrator(&o.orderRepo, o.checkoutSteps()...)
+	return o
 }
 
-func (o *OrderService) CreateOrder(ctx context.Context, order *entity.OrderEntity) (*entity.OrderEntity, error) {
-
-	// get the idempotent key from order
-	validate, err := o.validateIdempotentKey(ctx, order.IdempotentKey)
+func (o *OrderService) CreateOrder(ctx context.Context, order *entity.OrderEntity, actor string) (*entity.OrderEntity, error) {
+	// retries with the same idempotent key are answered by the idempotency
+	// middleware before they reach the service
+	var err error
+	order.OrderID, err = o.idGen.Next(sharding.SlotForUser(order.UserID))
 	if err != nil {
+		logger.Error().Err(err).Msgf("Error generating order ID")
 		return nil, err
 	}
-	if !validate {
-		return nil, errors.New("idempotent key already exists")
+	sent := sentTotals(order)
+	order.Status = entity.StatusPending
+	order.PriceFallback = false
+	if order.Currency == "" {
+		order.Currency = entity.DefaultCurrency
+	}
+	if err := lineCurrencyErrors(order); err != nil {
+		return nil, err
 	}
 
-	order.OrderID = randomOrderID()
-
-	availabilityCh := make(chan struct {
-		ProductID int
-		Available bool
-		Err       error
-	}, len(order.ProductRequests))
-
-	pricingCh := make(chan struct {
-		ProductID  int
-		FinalPrice float64
-		MarkUp     float64
-		Discount   float64
-		Err        error
-	}, len(order.ProductRequests))
-
-	for _, productRequest := range order.ProductRequests {
-
-		// 1. proses syncronus
-
-		// check product availability
-		// available, err := o.checkProductStock(productRequest.ProductID, productRequest.Quantity)
-		//  if err != nil {
-		// 	logger.Error().Err(err).Msgf("Error checking product stock for product %d", productRequest.ProductID)
-		// 	return nil, err
-		//  }
-		// get pricing
-		// pricing, err := o.GetPricing(productRequest.ProductID)
-		// if err != nil {
-		// 	logger.Error().Err(err).Msgf("Error getting pricing for product  %d", productRequest.ProductID)
-		// 	return  nil, err
-		// }
-
-		// if !available {
-		// 	logger.Warn().Msgf("product %d out of stock", productRequest.ProductID)
-		// 	return  nil, fmt.Errorf("product out of stock")
-		// }
-
-		// productRequest.FinalPrice = float64(productRequest.Quantity)*pricing.FinalPrice
-		// productRequest.MarkUp = float64(productRequest.Quantity)* pricing.Markup
-		// productRequest.Discount = float64(productRequest.Quantity)* pricing.Discount
-
-		// 2. proses asyncronus
-		// go routine proses cek available stock product
-		go func(productRequest *entity.ProductRequest) {
-			available, err := o.checkProductStock(ctx, productRequest.ProductID, productRequest.Quantity)
-			availabilityCh <- struct {
-				ProductID int
-				Available bool
-				Err       error
-			}{
-				ProductID: productRequest.ProductID,
-				Available: available,
-				Err:       err,
-			}
-		}(&productRequest)
-
-		// go routine untuk pricing
-
-		go func(productRequest *entity.ProductRequest) {
-			pricing, err := o.GetPricing(ctx, productRequest.ProductID)
-			pricingCh <- struct {
-				ProductID  int
-				FinalPrice float64
-				MarkUp     float64
-				Discount   float64
-				Err        error
-			}{
-				ProductID:  pricing.ProductID,
-				FinalPrice: pricing.FinalPrice,
-				MarkUp:     pricing.Markup,
-				Discount:   pricing.Discount,
-				Err:        err,
-			}
-
-		}(&productRequest)
-
+	// an order made from a quote is charged the quoted prices, converted at
+	// the quoted rate
+	var lockedQuote *entity.Quote
+	if order.QuoteID != "" {
+		lockedQuote, err = o.quotes.Get(ctx, order.QuoteID)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("rejected quote %s", order.QuoteID)
+			return nil, err
+		}
+		if lockedQuote.UserID != order.UserID || lockedQuote.Currency != order.Currency {
+			return nil, entity.ErrInvalidQuote
+		}
+		order.PriceFallback = lockedQuote.PriceFallback
+		order.FXRate = lockedQuote.FXRate
+	} else {
+		order.FXRate, err = o.exchangeRate(ctx, order.Currency)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	for range order.ProductRequests {
-		availabilityResult := <-availabilityCh
-		pricingResult := <-pricingCh
+	productIDs := make([]int, len(order.ProductRequests))
+	for i, productRequest := range order.ProductRequests {
+		productIDs[i] = productRequest.ProductID
+	}
 
-		if availabilityResult.Err != nil {
-			logger.Error().Err(availabilityResult.Err).Msgf("Error checking product stock for product %d", availabilityResult.ProductID)
-			return nil, availabilityResult.Err
+	// one batch lookup per upstream, run concurrently, instead of two calls
+	// per line; the first failure cancels the other lookup
+	var stocks map[int]int
+	var pricings map[int]*entity.Pricing
+	g, lookupCtx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		var err error
+		stocks, err = o.productClient.GetStocks(lookupCtx, productIDs)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Error checking product stock for order %d", order.OrderID)
 		}
-
-		if !availabilityResult.Available {
-			logger.Warn().Msgf("product %d out of stock", availabilityResult.ProductID)
-			return nil, fmt.Errorf("product out of stock")
+		return err
+	})
+	g.Go(func() error {
+		if lockedQuote != nil {
+			pricings = quotedPricings(lockedQuote)
+			return nil
 		}
-
-		if pricingResult.Err != nil {
-			logger.Error().Err(pricingResult.Err).Msgf("Error getting pricing for product  %d", pricingResult.ProductID)
-			return nil, pricingResult.Err
+		var err error
+		pricings, err = o.pricingClient.GetPricings(lookupCtx, productIDs)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Error getting pricing for order %d", order.OrderID)
 		}
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
 
-		for _, productRequest := range order.ProductRequests {
-			if productRequest.ProductID == availabilityResult.ProductID {
-				productRequest.FinalPrice = float64(productRequest.Quantity) * pricingResult.FinalPrice
-				productRequest.MarkUp = float64(productRequest.Quantity) * pricingResult.MarkUp
-				productRequest.Discount = float64(productRequest.Quantity) * pricingResult.Discount
+	// lines are updated by index, so a product that appears on several
+	// lines is priced on each of them and its stock covers all of them;
+	// every rejected line is reported, not only the first
+	var lineErrs []entity.LineError
+	requested := make(map[int]int, len(order.ProductRequests))
+	var quoted map[int]int
+	if lockedQuote != nil {
+		quoted = quotedQuantities(lockedQuote)
+	}
+	for i := range order.ProductRequests {
+		productRequest := &order.ProductRequests[i]
+		productID := productRequest.ProductID
+		if productRequest.Quantity <= 0 {
+			lineErrs = append(lineErrs, entity.NewLineError(i, productID, entity.ErrInvalidQuantity))
+			continue
+		}
+		stock, ok := stocks[productID]
+		if !ok {
+			lineErrs = append(lineErrs, entity.NewLineError(i, productID, entity.ErrProductNotFound))
+			continue
+		}
+		basePricing, ok := pricings[productID]
+		if !ok || basePricing == nil {
+			if lockedQuote != nil {
+				lineErrs = append(lineErrs, entity.NewLineError(i, productID, fmt.Errorf("%w: product is not quoted", entity.ErrInvalidQuote)))
+			} else {
+				lineErrs = append(lineErrs, entity.NewLineError(i, productID, entity.ErrProductNotFound))
 			}
+			continue
+		}
+		requested[productID] += productRequest.Quantity
+		if lockedQuote != nil && requested[productID] > quoted[productID] {
+			lineErrs = append(lineErrs, entity.NewLineError(i, productID, fmt.Errorf("%w: quantity exceeds the quoted %d", entity.ErrInvalidQuote, quoted[productID])))
+			continue
+		}
+		if stock < requested[productID] {
+			logger.Warn().Msgf("product %d out of stock", productID)
+			lineErrs = append(lineErrs, entity.NewLineError(i, productID, entity.ErrOutOfStock))
+			continue
+		}
 
+		if basePricing.Stale {
+			order.PriceFallback = true
+		}
+		pricing, err := convertPricing(basePricing, order.FXRate)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Error converting pricing of product %d to %s", productID, order.Currency)
+			lineErrs = append(lineErrs, entity.NewLineError(i, productID, err))
+			continue
 		}
+		// unit prices are converted before they are multiplied, so every
+		// line is a whole number of minor units and the totals are exact
+		if err := priceLine(productRequest, pricing); err != nil {
+			lineErrs = append(lineErrs, entity.NewLineError(i, productID, err))
+			continue
+		}
+		// coupon discounts are only ever set by applyPromotions
+		productRequest.PromoDiscount = entity.NewMoney(0, order.Currency)
+		productRequest.Promotions = nil
+		productRequest.TaxCategory = basePricing.TaxCategory
 	}
-
-	// calculate order total
-	order.Total = 0
-	for _, productRequest := range order.ProductRequests {
-		order.Total += productRequest.FinalPrice
+	if len(lineErrs) > 0 {
+		return nil, &entity.OrderLinesError{Lines: lineErrs}
 	}
 
-	createdOrder, err := o.orderRepo.CreateOrder(order)
-	if err != nil {
-		logger.Error().Err(err).Msgf("Error creating order")
+	// coupons apply to the priced lines
+	if err := o.applyPromotions(ctx, order); err != nil {
 		return nil, err
 	}
-	// if env is set to test, return
-	if os.Getenv("ENV") == "test" {
-		return createdOrder, nil
+
+	// tax is due on the discounted lines
+	if err := o.tax.Calculate(ctx, order); err != nil {
+		logger.Warn().Err(err).Msgf("Error calculating tax of order %d", order.OrderID)
+		return nil, err
 	}
 
-	err = o.publishorderEvent(ctx, createdOrder, "created")
+	// client totals are never stored, only checked against the lines
+	computed, err := aggregateTotals(order)
 	if err != nil {
 		return nil, err
 	}
-	return createdOrder, nil
-}
-func (o *OrderService) UpdateOrder(ctx context.Context, order *entity.OrderEntity) (*entity.OrderEntity, error) {
-	if order.Status == "paid" {
-		// check product availability
-		for _, productRequest := range order.ProductRequests {
-			available, err := o.checkProductStock(ctx, productRequest.ProductID, productRequest.Quantity)
-			if err != nil {
-				logger.Error().Err(err).Msgf("error checking product stock for product %d", productRequest.ProductID)
-				return nil, err
-			}
-			if !available {
-				logger.Warn().Msgf("Product %d out of stock", productRequest.ProductID)
-				return nil, fmt.Errorf("product out of stock")
-			}
-		}
+	if err := sent.mismatch(computed); err != nil {
+		logger.Warn().Err(err).Msgf("rejected totals of order %d", order.OrderID)
+		return nil, err
+	}
+	if order.BaseTotal, err = baseAmount(order, order.Total); err != nil {
+		return nil, err
+	}
 
+	// a quote prices one order; consuming it here, after every check,
+	// leaves it usable when the order is rejected
+	if lockedQuote != nil {
+		if err := o.quotes.Consume(ctx, lockedQuote.ID); err != nil {
+			logger.Warn().Err(err).Msgf("rejected quote %s", lockedQuote.ID)
+			return nil, err
+		}
 	}
 
-	updateOrder, err := o.orderRepo.UpdateOrder(order)
-	if err != nil {
-		logger.Error().Err(err).Msgf("Error updating order")
+	// everything with side effects runs as a saga: a failing step undoes
+	// the steps before it, and a checkout cut short is resumed by the
+	// recovery scan. It returns once the payment was requested.
+	saga := &entity.CheckoutSaga{OrderID: order.OrderID, Actor: actor, Order: order}
+	if err := o.checkout.Start(ctx, saga); err != nil {
+		logger.Error().Err(err).Msgf("Error checking out order %d", order.OrderID)
 		return nil, err
 	}
+	return saga.Order, nil
+}
 
-	err = o.publishorderEvent(ctx, updateOrder, "updated")
+// UpdateOrder saves the order. A status different from the stored one is
+// applied as a transition and must be allowed by the order state machine.
+// The lines cannot be changed here, and the shipping region, which sets
+// the tax, only while the order is pending.
+// order.Version must be the version the update was made against; a stale
+// one fails with entity.ErrVersionMismatch rather than overwrite the
+// changes made since.
+func (o *OrderService) UpdateOrder(ctx context.Context, order *entity.OrderEntity, actor, reason string) (*entity.OrderEntity, error) {
+	if order.Version <= 0 {
+		return nil, entity.ErrVersionRequired
+	}
+	current, err := o.orderRepo.GetOrderByID(order.OrderID)
 	if err != nil {
+		logger.Error().Err(err).Msgf("Error getting order by ID %d", order.OrderID)
 		return nil, err
 	}
-
-	return updateOrder, nil
-}
-func (o *OrderService) CancelOrder(ctx context.Context, id int) (*entity.OrderEntity, error) {
-	order, err := o.orderRepo.GetOrderByID(id)
+	// the repository checks again when writing
+	if current.Version != order.Version {
+		return nil, entity.ErrVersionMismatch
+	}
+	sent := sentTotals(order)
+	order.ID = current.ID
+	order.UserID = current.UserID
+	order.CreatedAt = current.CreatedAt
+	order.PriceFallback = current.PriceFallback
+	order.QuoteID = current.QuoteID
+	order.Currency = current.Currency
+	order.FXRate = current.FXRate
+	order.CouponCodes = current.CouponCodes
+	if order.ShippingRegion == "" {
+		order.ShippingRegion = current.ShippingRegion
+	}
+	if err := lineCurrencyErrors(order); err != nil {
+		return nil, err
+	}
+	// the stored lines are kept, so no amount the client sent is used
+	if err := unchangedLines(current, order); err != nil {
+		return nil, err
+	}
+	order.ProductRequests = current.ProductRequests
+	// once the payment was requested the amount asked for is fixed, so the
+	// stored tax is kept
+	if current.Status == entity.StatusPending {
+		if err := o.tax.Calculate(ctx, order); err != nil {
+			logger.Warn().Err(err).Msgf("Error calculating tax of order %d", order.OrderID)
+			return nil, err
+		}
+	} else if order.ShippingRegion != current.ShippingRegion {
+		return nil, fmt.Errorf("%w: order is %s", entity.ErrRegionChangeNotAllowed, current.Status)
+	}
+	computed, err := aggregateTotals(order)
 	if err != nil {
-		logger.Error().Err(err).Msgf("Error getting order by ID %d", id)
 		return nil, err
 	}
-	order.Status = "cancelled"
+	if err := sent.mismatch(computed); err != nil {
+		logger.Warn().Err(err).Msgf("rejected totals of order %d", order.OrderID)
+		return nil, err
+	}
+	if order.BaseTotal, err = baseAmount(order, order.Total); err != nil {
+		return nil, err
+	}
 
-	updateOrder, err := o.orderRepo.UpdateOrder(order)
+	var transition *entity.StatusTransition
+	if order.Status == "" {
+		order.Status = current.Status
+	}
+	if order.Status != current.Status {
+		if !order.Status.IsValid() {
+			return nil, entity.ErrInvalidStatus
+		}
+		if order.Status.IsPaymentDriven() {
+			return nil, entity.ErrPaymentStatus
+		}
+		if !current.Status.CanTransitionTo(order.Status) {
+			return nil, &entity.TransitionError{From: current.Status, To: order.Status}
+		}
+		transition = &entity.StatusTransition{
+			OrderID: order.OrderID,
+			From:    current.Status,
+			To:      order.Status,
+			Actor:   actor,
+			Reason:  reason,
+		}
+	}
+
+	updateOrder, err := o.orderRepo.UpdateOrder(order, transition, actor)
 	if err != nil {
 		logger.Error().Err(err).Msgf("Error updating order")
 		return nil, err
 	}
-	err = o.publishorderEvent(ctx, updateOrder, "cancelled")
-	if err != nil {
-		return nil, err
+	if transition != nil {
+		o.settleReservation(ctx, updateOrder, transition.To)
 	}
+
 	return updateOrder, nil
 }
 
-func (o *OrderService) checkProductStock(ctx context.Context, productID int, quantity int) (bool, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/product/%d/stock", o.pricingServiceURL, productID))
-	if err != nil {
-		return false, err
+// unchangedLines rejects an update whose lines differ from the stored ones.
+// Lines are changed through CancelLine and ReduceLine, which record the
+// change and give back the reserved stock; an update without lines keeps
+// the stored ones.
+func unchangedLines(current, order *entity.OrderEntity) error {
+	if len(order.ProductRequests) == 0 {
+		return nil
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("product not valid")
+	if len(order.ProductRequests) != len(current.ProductRequests) {
+		return fmt.Errorf("%w: lines are changed through the line endpoints", entity.ErrLineChangeNotAllowed)
 	}
-
-	var stockData map[string]int
-	if err := json.NewDecoder(resp.Body).Decode(&stockData); err != nil {
-		return false, err
+	for i, sent := range order.ProductRequests {
+		stored := current.ProductRequests[i]
+		if sent.ProductID != stored.ProductID || sent.Quantity != stored.Quantity {
+			return fmt.Errorf("%w: lines are changed through the line endpoints", entity.ErrLineChangeNotAllowed)
+		}
 	}
+	return nil
+}
 
-	availableStock := stockData["stock"]
-	return availableStock >= quantity, nil
+func (o *OrderService) CancelOrder(ctx context.Context, orderID int64, actor, reason string) (*entity.OrderEntity, error) {
+	return o.TransitionOrder(ctx, orderID, entity.StatusCancelled, actor, reason)
+}
 
+// TransitionOrder moves an order to the given status if the state machine
+// allows it. The repository queues an event named after the new status. An
+// order that changes in the meantime is read again and checked anew.
+func (o *OrderService) TransitionOrder(ctx context.Context, orderID int64, to entity.OrderStatus, actor, reason string) (*entity.OrderEntity, error) {
+	if !to.IsValid() {
+		return nil, entity.ErrInvalidStatus
+	}
+	var order *entity.OrderEntity
+	err := retryOnConflict(ctx, func() error {
+		var err error
+		order, err = o.transitionOrder(ctx, orderID, to, actor, reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
 }
 
-func (o *OrderService) GetPricing(ctx context.Context, productID int) (*entity.Pricing, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/products/%d/pricing", o.pricingServiceURL, productID))
+func (o *OrderService) transitionOrder(ctx context.Context, orderID int64, to entity.OrderStatus, actor, reason string) (*entity.OrderEntity, error) {
+	order, err := o.orderRepo.GetOrderByID(orderID)
 	if err != nil {
+		logger.Error().Err(err).Msgf("Error getting order by ID %d", orderID)
 		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get pricing")
+	if !order.Status.CanTransitionTo(to) {
+		return nil, &entity.TransitionError{From: order.Status, To: to}
 	}
-	var pricing entity.Pricing
-	if err := json.NewDecoder(resp.Body).Decode(&pricing); err != nil {
+	if to == entity.StatusPaid {
+		if err := o.ensureReservation(ctx, order); err != nil {
+			return nil, err
+		}
+	}
+
+	err = o.orderRepo.UpdateOrderStatus(order, entity.StatusTransition{
+		OrderID: orderID,
+		From:    order.Status,
+		To:      to,
+		Actor:   actor,
+		Reason:  reason,
+	})
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error moving order %d from %s to %s", orderID, order.Status, to)
 		return nil, err
 	}
-	return &pricing, nil
+	o.settleReservation(ctx, order, to)
+	return order, nil
 }
 
-func (o *OrderService) publishorderEvent(ctx context.Context, order *entity.OrderEntity, key string) error {
-	orderJSON, err := json.Marshal(order)
+// ensureReservation makes sure an order about to be paid still holds its
+// stock, reserving it again if the reservation already expired.
+func (o *OrderService) ensureReservation(ctx context.Context, order *entity.OrderEntity) error {
+	_, err := o.reservations.Reserve(ctx, order.OrderID, reservationLines(order))
 	if err != nil {
-		return err
+		logger.Error().Err(err).Msgf("Error reserving stock for order %d", order.OrderID)
 	}
+	return err
+}
 
-	msg := kafka.Message{
-		Key:   []byte(fmt.Sprintf("order-%s-%d", key, order.ID)),
-		Value: orderJSON,
+// settleReservation converts or releases the stock held by an order once
+// its new status is stored, and gives back the coupon uses of orders that
+// will not complete. Failures are logged: the reservation TTL eventually
+// releases stock that was not settled.
+func (o *OrderService) settleReservation(ctx context.Context, order *entity.OrderEntity, status entity.OrderStatus) {
+	var err error
+	switch status {
+	case entity.StatusPaid:
+		err = o.reservations.Convert(ctx, order.OrderID)
+	case entity.StatusCancelled, entity.StatusExpired:
+		err = o.reservations.Release(ctx, order.OrderID)
+		o.releaseCoupons(ctx, order)
+	default:
+		return
 	}
-	err = o.kafkaWriter.WriteMessages(ctx, msg)
-	if err != nil {
-		return err
+	if err != nil && !errors.Is(err, entity.ErrReservationNotActive) {
+		logger.Error().Err(err).Msgf("Error settling stock reservation of order %d as %s", order.OrderID, status)
 	}
-	return nil
 }
 
-func (o *OrderService) validateIdempotentKey(ctx context.Context, key string) (bool, error) {
-	// if env is set to test, return true
-	if os.Getenv("ENV") == "test" {
-		return true, nil
-	}
-	// check if the key exists in the redis cache
-	// if it exists, return false
-	redisKey := fmt.Sprintf("idempotent-key:%s", key)
-	val, err := o.rdb.Get(ctx, redisKey).Result()
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return false, err
+// priceLine sets the amounts of a line to its quantity times the unit
+// pricing.
+func priceLine(line *entity.ProductRequest, pricing *entity.Pricing) error {
+	var err error
+	quantity := int64(line.Quantity)
+	if line.FinalPrice, err = pricing.FinalPrice.Mul(quantity); err != nil {
+		return err
 	}
-
-	if val != "" {
-		return false, errors.New("idempotent key already exists")
+	if line.MarkUp, err = pricing.Markup.Mul(quantity); err != nil {
+		return err
 	}
+	line.Discount, err = pricing.Discount.Mul(quantity)
+	return err
+}
 
-	// if it doesn't exist, add the key to the cache with a TTL of 24 hours
-	// and return true
-	err = o.rdb.Set(ctx, redisKey, "exists", 24*time.Hour).Err()
-
-	return true, nil
+func reservationLines(order *entity.OrderEntity) []entity.ReservationLine {
+	lines := make([]entity.ReservationLine, 0, len(order.ProductRequests))
+	for _, productRequest := range order.ProductRequests {
+		lines = append(lines, entity.ReservationLine{
+			ProductID: productRequest.ProductID,
+			Quantity:  productRequest.Quantity,
+		})
+	}
+	return lines
 }
 
-func randomOrderID() int {
-	return 1000 + rand.Intn(1000)
+func (o *OrderService) GetPricing(ctx context.Context, productID int) (*entity.Pricing, error) {
+	return o.pricingClient.GetPricing(ctx, productID)
 }
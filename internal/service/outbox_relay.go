@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"order-service/internal/entity"
+	"order-service/internal/lease"
+	"order-service/internal/repository"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	outboxBatchSize  = 100
+	outboxMaxBackoff = 5 * time.Minute
+)
+
+// OutboxRelay publishes the order events queued in every shard's outbox
+// table. A Redis lease per shard makes sure only one instance relays a
+// shard at a time, and events of the same order are published one after
+// the other so consumers see them in the order they were written.
+type OutboxRelay struct {
+	orderRepo   repository.OrderRepository
+	kafkaWriter *kafka.Writer
+	rdb         *redis.Client
+	interval    time.Duration
+}
+
+func NewOutboxRelay(orderRepo repository.OrderRepository, kafkaWriter *kafka.Writer, rdb *redis.Client, interval time.Duration) *OutboxRelay {
+	return &OutboxRelay{
+		orderRepo:   orderRepo,
+		kafkaWriter: kafkaWriter,
+		rdb:         rdb,
+		interval:    interval,
+	}
+}
+
+// Run relays until ctx is done.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	leases := make([]*lease.Lease, r.orderRepo.ShardCount())
+	for shard := range leases {
+		leases[shard] = lease.New(r.rdb, fmt.Sprintf("outbox-relay:shard:%d", shard), 3*r.interval+10*time.Second)
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		for shard, l := range leases {
+			held, err := l.Acquire(ctx)
+			if err != nil {
+				logger.Error().Err(err).Msgf("error acquiring outbox lease for shard %d", shard)
+				continue
+			}
+			if !held {
+				continue
+			}
+			if err := r.relayShard(ctx, shard, l); err != nil {
+				logger.Error().Err(err).Msgf("error relaying outbox of shard %d", shard)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			for _, l := range leases {
+				l.Release(context.Background())
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayShard publishes pending messages of a shard in rounds. Each round
+// sends at most the oldest pending message of every order, so a failed
+// message holds back the later messages of its order until it goes out.
+// The lease is renewed before every round and relaying stops once it is
+// lost, so a slow shard is never relayed by two instances at once.
+func (r *OutboxRelay) relayShard(ctx context.Context, shard int, l *lease.Lease) error {
+	for {
+		held, err := l.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		if !held {
+			logger.Warn().Msgf("lost outbox lease for shard %d", shard)
+			return nil
+		}
+		due, err := r.orderRepo.PendingOutboxMessages(shard, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+
+		kafkaMessages := make([]kafka.Message, len(due))
+		for i, m := range due {
+			kafkaMessages[i] = kafka.Message{
+				Key:   []byte(fmt.Sprintf("order-%d", m.OrderID)),
+				Value: m.Payload,
+				Headers: []kafka.Header{
+					{Key: "event_type", Value: []byte(m.EventType)},
+				},
+			}
+		}
+		err = r.kafkaWriter.WriteMessages(ctx, kafkaMessages...)
+
+		var writeErrs kafka.WriteErrors
+		if err != nil && !errors.As(err, &writeErrs) {
+			// nothing was written, retry the whole round later
+			for _, m := range due {
+				r.markFailed(shard, m, err)
+			}
+			return err
+		}
+
+		sent := make([]int64, 0, len(due))
+		for i, m := range due {
+			if writeErrs != nil && writeErrs[i] != nil {
+				r.markFailed(shard, m, writeErrs[i])
+				continue
+			}
+			sent = append(sent, m.ID)
+		}
+		if err := r.orderRepo.MarkOutboxSent(shard, sent); err != nil {
+			return err
+		}
+		if len(sent) == 0 {
+			return nil
+		}
+	}
+}
+
+func (r *OutboxRelay) markFailed(shard int, m entity.OutboxMessage, publishErr error) {
+	backoff := time.Second << min(m.Attempts, 16)
+	if backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+	logger.Warn().Err(publishErr).Msgf("error publishing outbox message %d of order %d, attempt %d", m.ID, m.OrderID, m.Attempts+1)
+	if err := r.orderRepo.MarkOutboxFailed(shard, m.ID, publishErr, time.Now().Add(backoff)); err != nil {
+		logger.Error().Err(err).Msgf("error recording failed outbox message %d", m.ID)
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"order-service/internal/entity"
+)
+
+// paymentActor is recorded as the actor of transitions made by payment
+// events.
+const paymentActor = "payment-service"
+
+// ApplyPaymentEvent moves an order to the status a payment event calls for.
+// Events that arrive after the order already got there, or that no longer
+// matter, are recorded and ignored. Every event is applied at most once.
+// A refund event with a return ID refunds that return only. Errors wrapping
+// entity.ErrInvalidPaymentEvent, entity.ErrOrderNotFound or a return error,
+// and transition errors, will fail again on redelivery. An order that
+// changes while the event is applied is read again.
+func (o *OrderService) ApplyPaymentEvent(ctx context.Context, event entity.PaymentEvent) error {
+	if event.EventID == "" || event.OrderID == 0 {
+		return fmt.Errorf("%w: event_id and order_id are required", entity.ErrInvalidPaymentEvent)
+	}
+	return retryOnConflict(ctx, func() error {
+		return o.applyPaymentEvent(ctx, event)
+	})
+}
+
+func (o *OrderService) applyPaymentEvent(ctx context.Context, event entity.PaymentEvent) error {
+	order, err := o.orderRepo.GetOrderByID(event.OrderID)
+	if err != nil {
+		return err
+	}
+
+	var to entity.OrderStatus
+	switch event.Type {
+	case entity.PaymentSucceeded:
+		switch order.Status {
+		case entity.StatusPending, entity.StatusAwaitingPayment:
+			if !event.Amount.IsZero() && !event.Amount.Equal(order.Total) {
+				return fmt.Errorf("%w: paid %s %s for a total of %s %s", entity.ErrInvalidPaymentEvent,
+					event.Amount, event.Amount.Currency, order.Total, order.Total.Currency)
+			}
+			to = entity.StatusPaid
+		case entity.StatusCancelled, entity.StatusExpired:
+			// the money has to go back; that is for an operator to sort out
+			return &entity.TransitionError{From: order.Status, To: entity.StatusPaid}
+		}
+	case entity.PaymentFailed:
+		// a failed attempt after a successful one changes nothing
+		if order.Status == entity.StatusPending || order.Status == entity.StatusAwaitingPayment {
+			to = entity.StatusCancelled
+		}
+	case entity.PaymentRefunded:
+		if event.ReturnID != 0 {
+			return o.settleReturn(ctx, order, event)
+		}
+		if order.Status != entity.StatusRefunded {
+			if !order.Status.CanTransitionTo(entity.StatusRefunded) {
+				return &entity.TransitionError{From: order.Status, To: entity.StatusRefunded}
+			}
+			to = entity.StatusRefunded
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", entity.ErrInvalidPaymentEvent, event.Type)
+	}
+
+	if to == "" {
+		_, err := o.orderRepo.ApplyPaymentEvent(order, event, nil)
+		return err
+	}
+
+	// paid orders come from awaiting_payment; an order paid before the
+	// client moved it there gets both steps
+	if to == entity.StatusPaid {
+		if order.Status == entity.StatusPending {
+			err := o.orderRepo.UpdateOrderStatus(order, entity.StatusTransition{
+				OrderID: order.OrderID,
+				From:    entity.StatusPending,
+				To:      entity.StatusAwaitingPayment,
+				Actor:   paymentActor,
+				Reason:  fmt.Sprintf("%s %s", event.Type, event.EventID),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := o.ensureReservation(ctx, order); err != nil {
+			return err
+		}
+	}
+
+	transition := &entity.StatusTransition{
+		OrderID: order.OrderID,
+		From:    order.Status,
+		To:      to,
+		Actor:   paymentActor,
+		Reason:  fmt.Sprintf("%s %s", event.Type, event.EventID),
+	}
+	applied, err := o.orderRepo.ApplyPaymentEvent(order, event, transition)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error applying %s %s to order %d", event.Type, event.EventID, order.OrderID)
+		return err
+	}
+	if !applied {
+		logger.Info().Msgf("payment event %s of order %d already processed", event.EventID, order.OrderID)
+		return nil
+	}
+	o.settleReservation(ctx, order, to)
+	// the checkout waits for exactly this
+	o.resumeCheckout(ctx, order.OrderID)
+	return nil
+}
+
+// permanentPaymentError reports whether processing a payment event again
+// cannot succeed.
+func permanentPaymentError(err error) bool {
+	var transitionErr *entity.TransitionError
+	return errors.Is(err, entity.ErrInvalidPaymentEvent) || errors.Is(err, entity.ErrOrderNotFound) ||
+		errors.Is(err, entity.ErrOutOfStock) || errors.Is(err, entity.ErrReturnNotFound) ||
+		errors.Is(err, entity.ErrReturnNotAllowed) || errors.As(err, &transitionErr)
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"order-service/internal/entity"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const paymentMaxBackoff = 30 * time.Second
+
+// PaymentConsumer applies the events of the payment topic to orders.
+// Events that can never be applied are copied to a dead-letter topic with
+// the error and skipped; other failures are retried until they succeed, so
+// the events of a partition are applied in order.
+type PaymentConsumer struct {
+	reader     *kafka.Reader
+	deadLetter *kafka.Writer
+	orders     *OrderService
+}
+
+func NewPaymentConsumer(reader *kafka.Reader, deadLetter *kafka.Writer, orders *OrderService) *PaymentConsumer {
+	return &PaymentConsumer{
+		reader:     reader,
+		deadLetter: deadLetter,
+		orders:     orders,
+	}
+}
+
+// Run consumes until ctx is done and then closes the reader.
+func (p *PaymentConsumer) Run(ctx context.Context) {
+	defer p.reader.Close()
+	for {
+		msg, err := p.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error().Err(err).Msgf("error reading payment event")
+			continue
+		}
+		if !p.handle(ctx, msg) {
+			return
+		}
+		if err := p.reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			logger.Error().Err(err).Msgf("error committing payment event at offset %d", msg.Offset)
+		}
+	}
+}
+
+// handle applies a message, or dead-letters it, retrying transient
+// failures. It returns false when ctx is done first.
+func (p *PaymentConsumer) handle(ctx context.Context, msg kafka.Message) bool {
+	backoff := time.Second
+	for {
+		err := p.apply(ctx, msg)
+		if err == nil {
+			return true
+		}
+		if permanentPaymentError(err) {
+			logger.Warn().Err(err).Msgf("dead-lettering payment event at offset %d", msg.Offset)
+			err = p.deadLetterMessage(ctx, msg, err)
+			if err == nil {
+				return true
+			}
+		}
+		logger.Error().Err(err).Msgf("error handling payment event at offset %d, retrying in %s", msg.Offset, backoff)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, paymentMaxBackoff)
+	}
+}
+
+func (p *PaymentConsumer) apply(ctx context.Context, msg kafka.Message) error {
+	var event entity.PaymentEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		return fmt.Errorf("%w: %v", entity.ErrInvalidPaymentEvent, err)
+	}
+	// producers may only name the type in the event_type header
+	if event.Type == "" {
+		for _, header := range msg.Headers {
+			if header.Key == "event_type" {
+				event.Type = entity.PaymentEventType(header.Value)
+			}
+		}
+	}
+	return p.orders.ApplyPaymentEvent(ctx, event)
+}
+
+// deadLetterMessage copies msg to the dead-letter topic, noting where it
+// came from and why it was rejected.
+func (p *PaymentConsumer) deadLetterMessage(ctx context.Context, msg kafka.Message, reason error) error {
+	headers := append([]kafka.Header(nil), msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: "dead_letter_error", Value: []byte(reason.Error())},
+		kafka.Header{Key: "dead_letter_topic", Value: []byte(msg.Topic)},
+		kafka.Header{Key: "dead_letter_partition", Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: "dead_letter_offset", Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+	)
+	return p.deadLetter.WriteMessages(ctx, kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"order-service/internal/client"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// priceChangeEvent is a message of the price change topic. Either field
+// names the products whose price changed.
+type priceChangeEvent struct {
+	ProductID  int   `json:"product_id"`
+	ProductIDs []int `json:"product_ids"`
+}
+
+// PriceChangeConsumer drops cached pricing when the pricing service
+// announces a price change. The cache lives in Redis and is shared by every
+// instance, so all instances consume with the same group ID.
+type PriceChangeConsumer struct {
+	reader *kafka.Reader
+	cache  *client.CachedPricingClient
+}
+
+func NewPriceChangeConsumer(reader *kafka.Reader, cache *client.CachedPricingClient) *PriceChangeConsumer {
+	return &PriceChangeConsumer{
+		reader: reader,
+		cache:  cache,
+	}
+}
+
+// Run consumes until ctx is done and then closes the reader.
+func (p *PriceChangeConsumer) Run(ctx context.Context) {
+	defer p.reader.Close()
+	for {
+		msg, err := p.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error().Err(err).Msgf("error reading price change")
+			continue
+		}
+
+		var event priceChangeEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			// a malformed message never becomes valid, skip it
+			logger.Error().Err(err).Msgf("invalid price change at offset %d", msg.Offset)
+		} else if !p.invalidate(ctx, event) {
+			return
+		}
+
+		if err := p.reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			logger.Error().Err(err).Msgf("error committing price change at offset %d", msg.Offset)
+		}
+	}
+}
+
+// invalidate retries until the cache entries are dropped, so a short Redis
+// outage cannot leave old prices cached for the rest of their TTL. It
+// returns false when ctx is done first.
+func (p *PriceChangeConsumer) invalidate(ctx context.Context, event priceChangeEvent) bool {
+	productIDs := event.ProductIDs
+	if event.ProductID != 0 {
+		productIDs = append(productIDs, event.ProductID)
+	}
+	for {
+		err := p.cache.Invalidate(ctx, productIDs...)
+		if err == nil {
+			return true
+		}
+		logger.Error().Err(err).Msgf("error invalidating pricing of products %v", productIDs)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"order-service/internal/entity"
+	"order-service/internal/promotion"
+	"time"
+)
+
+// applyPromotions takes the discounts of the order's coupons off its priced
+// lines. Codes are normalised and repeated codes count once. The coupon
+// uses are counted later, by the checkout.
+func (o *OrderService) applyPromotions(ctx context.Context, order *entity.OrderEntity) error {
+	seen := make(map[string]bool, len(order.CouponCodes))
+	codes := make([]string, 0, len(order.CouponCodes))
+	for _, code := range order.CouponCodes {
+		code = promotion.NormalizeCode(code)
+		if code != "" && !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	order.CouponCodes = codes
+	if len(codes) == 0 {
+		return nil
+	}
+
+	promotions, err := o.promotions.Get(ctx, codes)
+	if err != nil {
+		logger.Warn().Err(err).Msgf("Error loading coupons %v", codes)
+		return err
+	}
+	if err := promotion.Apply(order, promotions, time.Now()); err != nil {
+		logger.Warn().Err(err).Msgf("Error applying coupons %v to order %d", codes, order.OrderID)
+		return err
+	}
+	return nil
+}
+
+// releaseCoupons gives back the coupon uses of an order that will not be
+// completed. Failures are logged; the uses stay counted.
+func (o *OrderService) releaseCoupons(ctx context.Context, order *entity.OrderEntity) {
+	if err := o.promotions.Release(ctx, order.OrderID, order.UserID, order.CouponCodes); err != nil {
+		logger.Error().Err(err).Msgf("Error releasing coupons %v of order %d", order.CouponCodes, order.OrderID)
+	}
+}
+
+func (o *OrderService) SavePromotion(ctx context.Context, p *entity.Promotion) error {
+	if err := o.promotions.Save(ctx, p); err != nil {
+		logger.Error().Err(err).Msgf("Error saving promotion %s", p.Code)
+		return err
+	}
+	return nil
+}
+
+func (o *OrderService) GetPromotion(ctx context.Context, code string) (*entity.Promotion, error) {
+	promotions, err := o.promotions.Get(ctx, []string{promotion.NormalizeCode(code)})
+	if err != nil {
+		return nil, err
+	}
+	return promotions[0], nil
+}
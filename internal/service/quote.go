@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"order-service/internal/entity"
+)
+
+// CreateQuote prices the requested lines and stores the prices as a signed
+// quote. Orders created with the quote ID before it expires are charged
+// these prices.
+func (o *OrderService) CreateQuote(ctx context.Context, userID int, currency string, productRequests []entity.ProductRequest) (*entity.Quote, error) {
+	if currency == "" {
+		currency = entity.DefaultCurrency
+	}
+	rate, err := o.exchangeRate(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	productIDs := make([]int, len(productRequests))
+	for i, productRequest := range productRequests {
+		productIDs[i] = productRequest.ProductID
+	}
+	pricings, err := o.pricingClient.GetPricings(ctx, productIDs)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error getting pricing for quote of user %d", userID)
+		return nil, err
+	}
+
+	q := &entity.Quote{
+		UserID:   userID,
+		Lines:    make([]entity.QuoteLine, 0, len(productRequests)),
+		Currency: currency,
+		FXRate:   rate,
+	}
+	var lineErrs []entity.LineError
+	for i, productRequest := range productRequests {
+		if productRequest.Quantity <= 0 {
+			lineErrs = append(lineErrs, entity.NewLineError(i, productRequest.ProductID, entity.ErrInvalidQuantity))
+			continue
+		}
+		pricing, ok := pricings[productRequest.ProductID]
+		if !ok || pricing == nil {
+			lineErrs = append(lineErrs, entity.NewLineError(i, productRequest.ProductID, entity.ErrProductNotFound))
+			continue
+		}
+		if pricing.Stale {
+			q.PriceFallback = true
+		}
+		localPricing, err := convertPricing(pricing, rate)
+		if err != nil {
+			lineErrs = append(lineErrs, entity.NewLineError(i, productRequest.ProductID, err))
+			continue
+		}
+		q.Lines = append(q.Lines, entity.QuoteLine{
+			ProductID:    productRequest.ProductID,
+			Quantity:     productRequest.Quantity,
+			Pricing:      *pricing,
+			LocalPricing: *localPricing,
+		})
+	}
+	if len(lineErrs) > 0 {
+		return nil, &entity.OrderLinesError{Lines: lineErrs}
+	}
+	if err := o.quotes.Save(ctx, q); err != nil {
+		logger.Error().Err(err).Msgf("Error saving quote of user %d", userID)
+		return nil, err
+	}
+	return q, nil
+}
+
+// quotedQuantities returns how many units of every product the quote
+// covers.
+func quotedQuantities(q *entity.Quote) map[int]int {
+	quantities := make(map[int]int, len(q.Lines))
+	for _, line := range q.Lines {
+		quantities[line.ProductID] += line.Quantity
+	}
+	return quantities
+}
+
+// quotedPricings returns the quoted pricing of every product of the quote.
+// Products the quote does not cover are left out.
+func quotedPricings(q *entity.Quote) map[int]*entity.Pricing {
+	pricings := make(map[int]*entity.Pricing, len(q.Lines))
+	for i := range q.Lines {
+		pricings[q.Lines[i].ProductID] = &q.Lines[i].Pricing
+	}
+	return pricings
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"context"
+	"order-service/internal/entity"
+	"time"
+)
+
+func (o *OrderService) GetReservation(ctx context.Context, orderID int64) (*entity.StockReservation, error) {
+	return o.reservations.Get(ctx, orderID)
+}
+
+func (o *OrderService) ListReservations(ctx context.Context, offset, limit int) ([]*entity.StockReservation, error) {
+	if limit <= 0 || limit > maxPageSize {
+		limit = defaultPageSize
+	}
+	return o.reservations.List(ctx, offset, limit)
+}
+
+func (o *OrderService) GetStockLevel(ctx context.Context, productID int) (*entity.StockLevel, error) {
+	return o.reservations.StockLevel(ctx, productID)
+}
+
+// RunReservationSweeper releases the stock of reservations whose TTL has
+// passed, until ctx is done.
+func (o *OrderService) RunReservationSweeper(ctx context.Context, interval time.Duration) {
+	o.reservations.RunSweeper(ctx, interval)
+}
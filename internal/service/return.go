@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"order-service/internal/entity"
+	"order-service/internal/idgen"
+)
+
+// RequestReturn asks to return quantity units of a line of an order that
+// was paid. The refund amounts are an estimate until the return is
+// approved.
+func (o *OrderService) RequestReturn(ctx context.Context, orderID int64, index, quantity int, actor, reason string) (*entity.ReturnRequest, error) {
+	if quantity <= 0 {
+		return nil, entity.ErrInvalidQuantity
+	}
+	order, err := o.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error getting order by ID %d", orderID)
+		return nil, err
+	}
+	if !order.Status.IsReturnable() {
+		return nil, fmt.Errorf("%w: order is %s", entity.ErrReturnNotAllowed, order.Status)
+	}
+	if index < 0 || index >= len(order.ProductRequests) {
+		return nil, entity.ErrLineNotFound
+	}
+	returns, err := o.orderRepo.ListReturns(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	line := order.ProductRequests[index]
+	ret := &entity.ReturnRequest{
+		OrderID:   orderID,
+		LineIndex: index,
+		ProductID: line.ProductID,
+		Quantity:  quantity,
+		Reason:    reason,
+		Status:    entity.ReturnRequested,
+		Actor:     actor,
+	}
+	if err := setRefund(ret, line, refundedQuantity(returns, index, 0)); err != nil {
+		return nil, err
+	}
+	if ret.ReturnID, err = o.idGen.Next(idgen.Slot(orderID)); err != nil {
+		return nil, err
+	}
+	// the repository checks the quantity against the other returns of the
+	// line under a lock
+	if err := o.orderRepo.CreateReturn(ret, line.Quantity); err != nil {
+		logger.Error().Err(err).Msgf("Error requesting return of line %d of order %d", index, orderID)
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ApproveReturn settles the refund amounts of a requested return and asks
+// for the refund.
+func (o *OrderService) ApproveReturn(ctx context.Context, orderID, returnID int64, actor, note string) (*entity.ReturnRequest, error) {
+	order, ret, returns, err := o.getReturn(orderID, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReviewer(ret, actor); err != nil {
+		return nil, err
+	}
+	if ret.Status != entity.ReturnRequested {
+		return nil, fmt.Errorf("%w: return is %s", entity.ErrReturnNotAllowed, ret.Status)
+	}
+	if ret.LineIndex >= len(order.ProductRequests) {
+		return nil, entity.ErrLineNotFound
+	}
+
+	if err := setRefund(ret, order.ProductRequests[ret.LineIndex], refundedQuantity(returns, ret.LineIndex, ret.ReturnID)); err != nil {
+		return nil, err
+	}
+	ret.Status = entity.ReturnApproved
+	ret.Reviewer = actor
+	ret.Note = note
+	if err := o.orderRepo.ReviewReturn(order, ret, entity.ReturnRequested, "refund_requested"); err != nil {
+		logger.Error().Err(err).Msgf("Error approving return %d of order %d", returnID, orderID)
+		return nil, err
+	}
+	return ret, nil
+}
+
+// RejectReturn turns down a requested return. Its units can be requested
+// again.
+func (o *OrderService) RejectReturn(ctx context.Context, orderID, returnID int64, actor, note string) (*entity.ReturnRequest, error) {
+	order, ret, _, err := o.getReturn(orderID, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReviewer(ret, actor); err != nil {
+		return nil, err
+	}
+	if ret.Status != entity.ReturnRequested {
+		return nil, fmt.Errorf("%w: return is %s", entity.ErrReturnNotAllowed, ret.Status)
+	}
+
+	ret.Status = entity.ReturnRejected
+	ret.Reviewer = actor
+	ret.Note = note
+	if err := o.orderRepo.ReviewReturn(order, ret, entity.ReturnRequested, ""); err != nil {
+		logger.Error().Err(err).Msgf("Error rejecting return %d of order %d", returnID, orderID)
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (o *OrderService) ListReturns(ctx context.Context, orderID int64) ([]*entity.ReturnRequest, error) {
+	if _, err := o.orderRepo.GetOrderByID(orderID); err != nil {
+		return nil, err
+	}
+	return o.orderRepo.ListReturns(orderID)
+}
+
+// settleReturn applies a refund event for one approved return. The order
+// becomes refunded once every unit of every line is refunded, and
+// partially_refunded until then.
+func (o *OrderService) settleReturn(ctx context.Context, order *entity.OrderEntity, event entity.PaymentEvent) error {
+	returns, err := o.orderRepo.ListReturns(order.OrderID)
+	if err != nil {
+		return err
+	}
+	var ret *entity.ReturnRequest
+	for _, r := range returns {
+		if r.ReturnID == event.ReturnID {
+			ret = r
+		}
+	}
+	if ret == nil {
+		return fmt.Errorf("%w: return %d", entity.ErrReturnNotFound, event.ReturnID)
+	}
+	switch ret.Status {
+	case entity.ReturnApproved:
+	case entity.ReturnRefunded:
+		// refunded by an earlier event
+		_, err := o.orderRepo.ApplyPaymentEvent(order, event, nil)
+		return err
+	default:
+		return fmt.Errorf("%w: return %d is %s", entity.ErrReturnNotAllowed, ret.ReturnID, ret.Status)
+	}
+	if !event.Amount.IsZero() && !event.Amount.Equal(ret.RefundAmount) {
+		return fmt.Errorf("%w: refunded %s %s for a return of %s %s", entity.ErrInvalidPaymentEvent,
+			event.Amount, event.Amount.Currency, ret.RefundAmount, ret.RefundAmount.Currency)
+	}
+	ret.Status = entity.ReturnRefunded
+
+	to := entity.StatusRefunded
+	for i, line := range order.ProductRequests {
+		if refunded(returns, i) < line.Quantity {
+			to = entity.StatusPartiallyRefunded
+			break
+		}
+	}
+	var transition *entity.StatusTransition
+	if order.Status != to {
+		if !order.Status.CanTransitionTo(to) {
+			return &entity.TransitionError{From: order.Status, To: to}
+		}
+		transition = &entity.StatusTransition{
+			OrderID: order.OrderID,
+			From:    order.Status,
+			To:      to,
+			Actor:   paymentActor,
+			Reason:  fmt.Sprintf("%s %s for return %d", event.Type, event.EventID, ret.ReturnID),
+		}
+	}
+
+	applied, err := o.orderRepo.SettleReturn(order, ret, event, transition, paymentActor)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error settling return %d of order %d", ret.ReturnID, order.OrderID)
+		return err
+	}
+	if !applied {
+		logger.Info().Msgf("payment event %s of order %d already processed", event.EventID, order.OrderID)
+	}
+	return nil
+}
+
+func (o *OrderService) getReturn(orderID, returnID int64) (*entity.OrderEntity, *entity.ReturnRequest, []*entity.ReturnRequest, error) {
+	order, err := o.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error getting order by ID %d", orderID)
+		return nil, nil, nil, err
+	}
+	returns, err := o.orderRepo.ListReturns(orderID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, ret := range returns {
+		if ret.ReturnID == returnID {
+			return order, ret, returns, nil
+		}
+	}
+	return nil, nil, nil, entity.ErrReturnNotFound
+}
+
+// checkReviewer keeps whoever requested a return from reviewing it.
+func checkReviewer(ret *entity.ReturnRequest, actor string) error {
+	if actor == ret.Actor {
+		return fmt.Errorf("%w: %s requested the return and cannot review it", entity.ErrReturnNotAllowed, actor)
+	}
+	return nil
+}
+
+// refundedQuantity is how many units of a line approved or refunded
+// returns other than returnID give back.
+func refundedQuantity(returns []*entity.ReturnRequest, index int, returnID int64) int {
+	quantity := 0
+	for _, ret := range returns {
+		if ret.LineIndex == index && ret.ReturnID != returnID &&
+			(ret.Status == entity.ReturnApproved || ret.Status == entity.ReturnRefunded) {
+			quantity += ret.Quantity
+		}
+	}
+	return quantity
+}
+
+// refunded is how many units of a line refunded returns gave back.
+func refunded(returns []*entity.ReturnRequest, index int) int {
+	quantity := 0
+	for _, ret := range returns {
+		if ret.LineIndex == index && ret.Status == entity.ReturnRefunded {
+			quantity += ret.Quantity
+		}
+	}
+	return quantity
+}
+
+// setRefund sets the refund amounts of a return of a line that already
+// gave back base units. Each amount is the line's share for base+quantity
+// units less its share for base units, so the refunds of a line add up to
+// exactly its amounts once every unit is returned.
+func setRefund(ret *entity.ReturnRequest, line entity.ProductRequest, base int) error {
+	total := int64(line.Quantity)
+	var err error
+	share := func(m entity.Money) entity.Money {
+		upTo, upToErr := m.MulRat(int64(base+ret.Quantity), total, entity.RoundHalfEven)
+		before, beforeErr := m.MulRat(int64(base), total, entity.RoundHalfEven)
+		refund, subErr := upTo.Sub(before)
+		if err == nil {
+			err = errors.Join(upToErr, beforeErr, subErr)
+		}
+		return refund
+	}
+
+	discount, err := line.Discount.Add(line.PromoDiscount)
+	if err != nil {
+		return err
+	}
+	ret.RefundMarkUp = share(line.MarkUp)
+	ret.RefundDiscount = share(discount)
+	ret.RefundTax = share(line.Tax)
+	ret.RefundAmount = share(line.FinalPrice)
+	if err != nil {
+		return err
+	}
+	if !line.TaxInclusive {
+		ret.RefundAmount, err = ret.RefundAmount.Add(ret.RefundTax)
+	}
+	return err
+}
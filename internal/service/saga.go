@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"order-service/internal/entity"
+)
+
+// ErrStepPending is returned by a step that cannot finish yet, such as one
+// waiting for a payment. The saga stays on the step and runs it again when
+// it is resumed.
+var ErrStepPending = errors.New("saga step pending")
+
+// SagaStep is one step of a saga. Execute may run again after a crash, so
+// it must be idempotent, and it must leave nothing behind when it fails.
+// Compensate undoes a step that succeeded and must be idempotent too.
+type SagaStep interface {
+	Name() string
+	Execute(ctx context.Context, saga *entity.CheckoutSaga) error
+	Compensate(ctx context.Context, saga *entity.CheckoutSaga) error
+}
+
+// SagaStore persists saga state. Saves compare and set saga.Version, and
+// fail with entity.ErrSagaChanged when someone else saved the saga first.
+// OrderRepository implements it.
+type SagaStore interface {
+	SaveCheckoutSaga(saga *entity.CheckoutSaga) error
+}
+
+// sagaStep adapts a pair of functions to SagaStep.
+type sagaStep struct {
+	name       string
+	execute    func(ctx context.Context, saga *entity.CheckoutSaga) error
+	compensate func(ctx context.Context, saga *entity.CheckoutSaga) error
+}
+
+func (s sagaStep) Name() string {
+	return s.name
+}
+
+func (s sagaStep) Execute(ctx context.Context, saga *entity.CheckoutSaga) error {
+	return s.execute(ctx, saga)
+}
+
+func (s sagaStep) Compensate(ctx context.Context, saga *entity.CheckoutSaga) error {
+	if s.compensate == nil {
+		return nil
+	}
+	return s.compensate(ctx, saga)
+}
+
+// SagaOrchestrator runs sagas step by step and saves their state after
+// every step. When a step fails, the steps before it are compensated in
+// reverse order. A saga whose state is saved as running or compensating
+// can be handed to Run again, by any instance, to carry on.
+type SagaOrchestrator struct {
+	store SagaStore
+	steps []SagaStep
+}
+
+func NewSagaOrchestrator(store SagaStore, steps ...SagaStep) *SagaOrchestrator {
+	return &SagaOrchestrator{
+		store: store,
+		steps: steps,
+	}
+}
+
+// Start saves a new saga and runs it.
+func (s *SagaOrchestrator) Start(ctx context.Context, saga *entity.CheckoutSaga) error {
+	saga.Step = 0
+	saga.Status = entity.SagaRunning
+	if err := s.store.SaveCheckoutSaga(saga); err != nil {
+		return err
+	}
+	return s.Run(ctx, saga)
+}
+
+// Run carries a saga on from its saved position. It returns nil when the
+// saga completed or waits on a pending step, and the error of the failed
+// step once the saga is compensated. If compensating fails too, the saga
+// is saved as compensating for a later Run to finish. Two runs of the same
+// saga cannot both carry on: the one that saves second stops with
+// entity.ErrSagaChanged.
+func (s *SagaOrchestrator) Run(ctx context.Context, saga *entity.CheckoutSaga) error {
+	switch saga.Status {
+	case entity.SagaRunning:
+		return s.forward(ctx, saga)
+	case entity.SagaCompensating:
+		if err := s.backward(ctx, saga); err != nil {
+			return err
+		}
+		return errors.New(saga.Error)
+	}
+	return nil
+}
+
+func (s *SagaOrchestrator) forward(ctx context.Context, saga *entity.CheckoutSaga) error {
+	for saga.Step < len(s.steps) {
+		step := s.steps[saga.Step]
+		err := step.Execute(ctx, saga)
+		if errors.Is(err, ErrStepPending) {
+			return s.store.SaveCheckoutSaga(saga)
+		}
+		if err != nil {
+			logger.Warn().Err(err).Msgf("checkout of order %d failed at %s, compensating", saga.OrderID, step.Name())
+			saga.Status = entity.SagaCompensating
+			saga.Error = fmt.Sprintf("%s: %v", step.Name(), err)
+			// claim the compensation before undoing anything another run
+			// may still build on
+			if saveErr := s.store.SaveCheckoutSaga(saga); saveErr != nil {
+				return saveErr
+			}
+			if err := s.backward(ctx, saga); err != nil {
+				logger.Error().Err(err).Msgf("checkout of order %d left to compensate later", saga.OrderID)
+			}
+			return err
+		}
+		// a failed save only means the step runs again when resumed
+		saga.Step++
+		if err := s.store.SaveCheckoutSaga(saga); err != nil {
+			return err
+		}
+	}
+	saga.Status = entity.SagaCompleted
+	return s.store.SaveCheckoutSaga(saga)
+}
+
+func (s *SagaOrchestrator) backward(ctx context.Context, saga *entity.CheckoutSaga) error {
+	for saga.Step > 0 {
+		step := s.steps[saga.Step-1]
+		if err := step.Compensate(ctx, saga); err != nil {
+			if saveErr := s.store.SaveCheckoutSaga(saga); saveErr != nil {
+				logger.Error().Err(saveErr).Msgf("Error saving checkout saga of order %d", saga.OrderID)
+			}
+			return fmt.Errorf("compensate %s: %w", step.Name(), err)
+		}
+		saga.Step--
+		if err := s.store.SaveCheckoutSaga(saga); err != nil {
+			return err
+		}
+	}
+	saga.Status = entity.SagaCompensated
+	return s.store.SaveCheckoutSaga(saga)
+}
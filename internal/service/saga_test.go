@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"order-service/internal/entity"
+	"reflect"
+	"testing"
+)
+
+// memorySagaStore keeps sagas in memory with the compare-and-set semantics
+// of the repository.
+type memorySagaStore struct {
+	sagas map[int64]entity.CheckoutSaga
+}
+
+func newMemorySagaStore() *memorySagaStore {
+	return &memorySagaStore{sagas: make(map[int64]entity.CheckoutSaga)}
+}
+
+func (m *memorySagaStore) SaveCheckoutSaga(saga *entity.CheckoutSaga) error {
+	stored, ok := m.sagas[saga.OrderID]
+	if ok != (saga.Version != 0) || stored.Version != saga.Version {
+		return entity.ErrSagaChanged
+	}
+	saga.Version++
+	m.sagas[saga.OrderID] = *saga
+	return nil
+}
+
+// load returns a copy of the stored saga, as a resuming instance reads it.
+func (m *memorySagaStore) load(t *testing.T, orderID int64) *entity.CheckoutSaga {
+	t.Helper()
+	saga, ok := m.sagas[orderID]
+	if !ok {
+		t.Fatalf("saga of order %d was not saved", orderID)
+	}
+	return &saga
+}
+
+// fakeStep fails, or stays pending, for as many calls as configured and
+// records every call in a shared log.
+type fakeStep struct {
+	name           string
+	log            *[]string
+	executeErrs    []error
+	compensateErrs []error
+}
+
+func (f *fakeStep) Name() string {
+	return f.name
+}
+
+func (f *fakeStep) Execute(ctx context.Context, saga *entity.CheckoutSaga) error {
+	*f.log = append(*f.log, "execute "+f.name)
+	return pop(&f.executeErrs)
+}
+
+func (f *fakeStep) Compensate(ctx context.Context, saga *entity.CheckoutSaga) error {
+	*f.log = append(*f.log, "compensate "+f.name)
+	return pop(&f.compensateErrs)
+}
+
+func pop(errs *[]error) error {
+	if len(*errs) == 0 {
+		return nil
+	}
+	err := (*errs)[0]
+	*errs = (*errs)[1:]
+	return err
+}
+
+func newSteps(log *[]string, names ...string) []*fakeStep {
+	steps := make([]*fakeStep, len(names))
+	for i, name := range names {
+		steps[i] = &fakeStep{name: name, log: log}
+	}
+	return steps
+}
+
+func newOrchestrator(store SagaStore, steps []*fakeStep) *SagaOrchestrator {
+	sagaSteps := make([]SagaStep, len(steps))
+	for i, step := range steps {
+		sagaSteps[i] = step
+	}
+	return NewSagaOrchestrator(store, sagaSteps...)
+}
+
+func assertLog(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("calls = %q, want %q", got, want)
+	}
+}
+
+func assertSaga(t *testing.T, saga *entity.CheckoutSaga, status entity.SagaStatus, step int) {
+	t.Helper()
+	if saga.Status != status || saga.Step != step {
+		t.Fatalf("saga is %s at step %d, want %s at step %d", saga.Status, saga.Step, status, step)
+	}
+}
+
+func TestSagaRunsEveryStepForward(t *testing.T) {
+	var log []string
+	store := newMemorySagaStore()
+	orchestrator := newOrchestrator(store, newSteps(&log, "reserve", "pay", "confirm"))
+
+	if err := orchestrator.Start(context.Background(), &entity.CheckoutSaga{OrderID: 1}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	assertLog(t, log, "execute reserve", "execute pay", "execute confirm")
+	assertSaga(t, store.load(t, 1), entity.SagaCompleted, 3)
+}
+
+func TestSagaCompensatesInReverseWhenAStepFails(t *testing.T) {
+	var log []string
+	store := newMemorySagaStore()
+	steps := newSteps(&log, "reserve", "pay", "confirm")
+	failure := errors.New("card declined")
+	steps[2].executeErrs = []error{failure}
+	orchestrator := newOrchestrator(store, steps)
+
+	err := orchestrator.Start(context.Background(), &entity.CheckoutSaga{OrderID: 1})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Start = %v, want %v", err, failure)
+	}
+	assertLog(t, log, "execute reserve", "execute pay", "execute confirm", "compensate pay", "compensate reserve")
+	saga := store.load(t, 1)
+	assertSaga(t, saga, entity.SagaCompensated, 0)
+	if saga.Error != "confirm: card declined" {
+		t.Fatalf("saga error = %q", saga.Error)
+	}
+}
+
+func TestSagaWaitsOnPendingStepAndResumes(t *testing.T) {
+	var log []string
+	store := newMemorySagaStore()
+	steps := newSteps(&log, "reserve", "await payment", "confirm")
+	steps[1].executeErrs = []error{ErrStepPending}
+	orchestrator := newOrchestrator(store, steps)
+
+	if err := orchestrator.Start(context.Background(), &entity.CheckoutSaga{OrderID: 1}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	assertSaga(t, store.load(t, 1), entity.SagaRunning, 1)
+
+	if err := orchestrator.Run(context.Background(), store.load(t, 1)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	assertLog(t, log, "execute reserve", "execute await payment", "execute await payment", "execute confirm")
+	assertSaga(t, store.load(t, 1), entity.SagaCompleted, 3)
+}
+
+func TestSagaLeavesFailedCompensationForALaterRun(t *testing.T) {
+	var log []string
+	store := newMemorySagaStore()
+	steps := newSteps(&log, "reserve", "pay", "confirm")
+	steps[2].executeErrs = []error{errors.New("card declined")}
+	steps[1].compensateErrs = []error{errors.New("payment service down")}
+	orchestrator := newOrchestrator(store, steps)
+
+	if err := orchestrator.Start(context.Background(), &entity.CheckoutSaga{OrderID: 1}); err == nil {
+		t.Fatal("Start succeeded, want the step error")
+	}
+	assertSaga(t, store.load(t, 1), entity.SagaCompensating, 2)
+
+	err := orchestrator.Run(context.Background(), store.load(t, 1))
+	if err == nil || err.Error() != "confirm: card declined" {
+		t.Fatalf("Run = %v, want the original step error", err)
+	}
+	assertLog(t, log, "execute reserve", "execute pay", "execute confirm", "compensate pay", "compensate pay", "compensate reserve")
+	assertSaga(t, store.load(t, 1), entity.SagaCompensated, 0)
+}
+
+func TestSagaRunStopsWhenAnotherRunSavedFirst(t *testing.T) {
+	var log []string
+	store := newMemorySagaStore()
+	steps := newSteps(&log, "reserve", "await payment", "confirm")
+	steps[1].executeErrs = []error{ErrStepPending}
+	orchestrator := newOrchestrator(store, steps)
+	if err := orchestrator.Start(context.Background(), &entity.CheckoutSaga{OrderID: 1}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	first, second := store.load(t, 1), store.load(t, 1)
+	if err := orchestrator.Run(context.Background(), first); err != nil {
+		t.Fatalf("first Run: %v", err)
+	}
+	if err := orchestrator.Run(context.Background(), second); !errors.Is(err, entity.ErrSagaChanged) {
+		t.Fatalf("second Run = %v, want %v", err, entity.ErrSagaChanged)
+	}
+	assertSaga(t, store.load(t, 1), entity.SagaCompleted, 3)
+}
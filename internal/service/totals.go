@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"order-service/internal/entity"
+)
+
+// orderTotals are the order-level aggregates of an order's lines.
+type orderTotals struct {
+	Quantity      int
+	Total         entity.Money
+	TotalMarkUp   entity.Money
+	TotalDiscount entity.Money
+	TotalTax      entity.Money
+}
+
+// sentTotals returns the totals an order arrived with, before the service
+// replaces them.
+func sentTotals(order *entity.OrderEntity) orderTotals {
+	return orderTotals{
+		Quantity:      order.Quantity,
+		Total:         order.Total,
+		TotalMarkUp:   order.TotalMarkUp,
+		TotalDiscount: order.TotalDiscount,
+		TotalTax:      order.TotalTax,
+	}
+}
+
+// aggregateTotals derives every order-level amount from the priced and
+// taxed lines and stores it on the order, whatever the client sent.
+// Exclusive tax is added to Total, inclusive tax already is in FinalPrice.
+func aggregateTotals(order *entity.OrderEntity) (orderTotals, error) {
+	totals := orderTotals{
+		Total:         entity.NewMoney(0, order.Currency),
+		TotalMarkUp:   entity.NewMoney(0, order.Currency),
+		TotalDiscount: entity.NewMoney(0, order.Currency),
+		TotalTax:      entity.NewMoney(0, order.Currency),
+	}
+	var err error
+	add := func(sum *entity.Money, m entity.Money) {
+		if err == nil {
+			*sum, err = sum.Add(m)
+		}
+	}
+	for _, productRequest := range order.ProductRequests {
+		totals.Quantity += productRequest.Quantity
+		add(&totals.Total, productRequest.FinalPrice)
+		if !productRequest.TaxInclusive {
+			add(&totals.Total, productRequest.Tax)
+		}
+		add(&totals.TotalMarkUp, productRequest.MarkUp)
+		add(&totals.TotalDiscount, productRequest.Discount)
+		add(&totals.TotalDiscount, productRequest.PromoDiscount)
+		add(&totals.TotalTax, productRequest.Tax)
+	}
+	if err != nil {
+		return orderTotals{}, err
+	}
+	order.Quantity = totals.Quantity
+	order.Total = totals.Total
+	order.TotalMarkUp = totals.TotalMarkUp
+	order.TotalDiscount = totals.TotalDiscount
+	order.TotalTax = totals.TotalTax
+	return totals, nil
+}
+
+// mismatch compares the totals a client sent with the computed ones.
+// Totals left out (zero) are not checked.
+func (sent orderTotals) mismatch(computed orderTotals) error {
+	if sent.Quantity != 0 && sent.Quantity != computed.Quantity {
+		return fmt.Errorf("%w: quantity is %d, computed %d", entity.ErrTotalsMismatch, sent.Quantity, computed.Quantity)
+	}
+	amounts := []struct {
+		field          string
+		sent, computed entity.Money
+	}{
+		{"total", sent.Total, computed.Total},
+		{"total_mark_up", sent.TotalMarkUp, computed.TotalMarkUp},
+		{"total_discount", sent.TotalDiscount, computed.TotalDiscount},
+		{"total_tax", sent.TotalTax, computed.TotalTax},
+	}
+	for _, a := range amounts {
+		if !a.sent.IsZero() && !a.sent.Equal(a.computed) {
+			return fmt.Errorf("%w: %s is %s %s, computed %s %s", entity.ErrTotalsMismatch, a.field, a.sent, a.sent.Currency, a.computed, a.computed.Currency)
+		}
+	}
+	return nil
+}
+
+// lineCurrencyErrors rejects lines whose amounts are not in the order's
+// currency; they cannot be added up with the rest of the order.
+func lineCurrencyErrors(order *entity.OrderEntity) error {
+	var lineErrs []entity.LineError
+	for i, productRequest := range order.ProductRequests {
+		for _, m := range []entity.Money{productRequest.MarkUp, productRequest.Discount, productRequest.FinalPrice, productRequest.PromoDiscount} {
+			if !m.IsZero() && m.Currency != "" && m.Currency != order.Currency {
+				err := fmt.Errorf("%w: line amounts must be in %s, not %s", entity.ErrUnsupportedCurrency, order.Currency, m.Currency)
+				lineErrs = append(lineErrs, entity.NewLineError(i, productRequest.ProductID, err))
+				break
+			}
+		}
+	}
+	if len(lineErrs) > 0 {
+		return &entity.OrderLinesError{Lines: lineErrs}
+	}
+	return nil
+}
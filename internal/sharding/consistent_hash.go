@@ -0,0 +1,97 @@
+package sharding
+
+import (
+	"fmt"
+	"hash/fnv"
+	"order-service/internal/idgen"
+	"sort"
+)
+
+type ringPoint struct {
+	hash  uint64
+	shard int
+}
+
+// ConsistentHashStrategy places every shard on a hash ring as a number of
+// virtual nodes proportional to its weight, and assigns a slot to the first
+// virtual node clockwise from the slot's hash. Adding a shard only moves the
+// slots that land on its virtual nodes.
+type ConsistentHashStrategy struct {
+	weights []int
+	ring    []ringPoint
+	// slots caches the ring lookup for every slot
+	slots []int
+}
+
+// NewConsistentHashStrategy builds a ring with vnodes virtual nodes per unit
+// of weight. weights[i] is the weight of shard i.
+func NewConsistentHashStrategy(weights []int, vnodes int) (*ConsistentHashStrategy, error) {
+	if len(weights) == 0 {
+		return nil, fmt.Errorf("sharding: consistent hash needs at least one shard")
+	}
+	if vnodes <= 0 {
+		return nil, fmt.Errorf("sharding: vnodes must be positive, got %d", vnodes)
+	}
+
+	c := &ConsistentHashStrategy{weights: weights}
+	for shard, weight := range weights {
+		if weight < 0 {
+			return nil, fmt.Errorf("sharding: shard %d has negative weight %d", shard, weight)
+		}
+		for v := 0; v < weight*vnodes; v++ {
+			c.ring = append(c.ring, ringPoint{
+				hash:  hashKey(fmt.Sprintf("shard-%d#%d", shard, v)),
+				shard: shard,
+			})
+		}
+	}
+	if len(c.ring) == 0 {
+		return nil, fmt.Errorf("sharding: every shard has weight 0")
+	}
+	sort.Slice(c.ring, func(a, b int) bool {
+		return c.ring[a].hash < c.ring[b].hash
+	})
+
+	c.slots = make([]int, idgen.SlotCount)
+	for slot := range c.slots {
+		c.slots[slot] = c.lookup(hashKey(fmt.Sprintf("slot-%d", slot)))
+	}
+	return c, nil
+}
+
+func (c *ConsistentHashStrategy) Name() string {
+	return "consistent"
+}
+
+func (c *ConsistentHashStrategy) ShardCount() int {
+	return len(c.weights)
+}
+
+func (c *ConsistentHashStrategy) ShardForSlot(slot int) int {
+	return c.slots[slot]
+}
+
+func (c *ConsistentHashStrategy) lookup(hash uint64) int {
+	i := sort.Search(len(c.ring), func(i int) bool {
+		return c.ring[i].hash >= hash
+	})
+	if i == len(c.ring) {
+		i = 0
+	}
+	return c.ring[i].shard
+}
+
+// hashKey hashes with FNV-1a and mixes the result, since the FNV hashes of
+// keys differing only in their last characters cluster on the ring.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	// finalizer of MurmurHash3
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,42 @@
+package sharding
+
+import "order-service/internal/idgen"
+
+// SlotRange is a run of consecutive slots, [Start, End), that move from one
+// shard to another.
+type SlotRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+	From  int `json:"from"`
+	To    int `json:"to"`
+}
+
+// Moves reports the slot ranges whose shard differs between two mappings,
+// i.e. the data that has to be copied when switching from one to the other.
+// A ShardRouter can be passed to include its topology overrides.
+func Moves(from, to SlotMapper) []SlotRange {
+	var moves []SlotRange
+	for slot := 0; slot < idgen.SlotCount; slot++ {
+		src, dst := from.ShardForSlot(slot), to.ShardForSlot(slot)
+		if src == dst {
+			continue
+		}
+		if n := len(moves); n > 0 && moves[n-1].End == slot && moves[n-1].From == src && moves[n-1].To == dst {
+			moves[n-1].End++
+			continue
+		}
+		moves = append(moves, SlotRange{Start: slot, End: slot + 1, From: src, To: dst})
+	}
+	return moves
+}
+
+// FirstSlot returns the lowest slot m maps to shard, and false when m maps
+// none to it.
+func FirstSlot(m SlotMapper, shard int) (int, bool) {
+	for slot := 0; slot < idgen.SlotCount; slot++ {
+		if m.ShardForSlot(slot) == shard {
+			return slot, true
+		}
+	}
+	return 0, false
+}
@@ -1,18 +1,99 @@
 // Package sharding
 package sharding
 
+import (
+	"order-service/internal/idgen"
+	"sync/atomic"
+)
+
+// SlotMapper maps the shard slot encoded in an order ID to a shard index.
+type SlotMapper interface {
+	ShardForSlot(slot int) int
+}
+
+// Strategy is a SlotMapper that can be selected from configuration.
+type Strategy interface {
+	SlotMapper
+	Name() string
+	ShardCount() int
+}
+
 type ShardRouter struct {
-	ShardCount int
+	strategy Strategy
+	topology atomic.Pointer[Topology]
 }
 
-func NewShardRouter(shardCount int) *ShardRouter {
+func NewShardRouter(strategy Strategy) *ShardRouter {
 	return &ShardRouter{
-		ShardCount: shardCount,
+		strategy: strategy,
 	}
 }
 
-func (r *ShardRouter) GetShard(id int) int {
-	// Hash the ID and get the shard index
-	shardIndex := id % r.ShardCount
-	return shardIndex
+func (r *ShardRouter) Strategy() Strategy {
+	return r.strategy
+}
+
+func (r *ShardRouter) ShardCount() int {
+	return r.strategy.ShardCount()
+}
+
+// GetShard returns the shard holding the order. The shard slot is encoded
+// in the order ID, so no lookup is needed.
+func (r *ShardRouter) GetShard(orderID int64) int {
+	return r.ShardForSlot(idgen.Slot(orderID))
+}
+
+func (r *ShardRouter) ShardForSlot(slot int) int {
+	if t := r.topology.Load(); t != nil {
+		if shard, ok := t.Overrides[slot]; ok {
+			return shard
+		}
+	}
+	return r.strategy.ShardForSlot(slot)
+}
+
+// DualWriteShard returns the shard that must also receive writes to the
+// order while its slot is being moved.
+func (r *ShardRouter) DualWriteShard(orderID int64) (int, bool) {
+	t := r.topology.Load()
+	if t == nil {
+		return 0, false
+	}
+	shard, ok := t.DualWrite[idgen.Slot(orderID)]
+	if !ok || shard == r.GetShard(orderID) {
+		return 0, false
+	}
+	return shard, true
+}
+
+// SlotForUser picks the shard slot of a new order. Orders of the same user
+// share a slot and therefore a shard.
+func SlotForUser(userID int) int {
+	slot := userID % idgen.SlotCount
+	if slot < 0 {
+		slot += idgen.SlotCount
+	}
+	return slot
+}
+
+// ModuloStrategy spreads slots round robin over the shards. Changing the
+// shard count moves most slots.
+type ModuloStrategy struct {
+	shards int
+}
+
+func NewModuloStrategy(shards int) *ModuloStrategy {
+	return &ModuloStrategy{shards: shards}
+}
+
+func (m *ModuloStrategy) Name() string {
+	return "modulo"
+}
+
+func (m *ModuloStrategy) ShardCount() int {
+	return m.shards
+}
+
+func (m *ModuloStrategy) ShardForSlot(slot int) int {
+	return slot % m.shards
 }
@@ -0,0 +1,176 @@
+package sharding
+
+import (
+	"order-service/internal/idgen"
+	"reflect"
+	"testing"
+)
+
+// slotMap maps the listed slots and leaves every other slot on shard 0.
+type slotMap map[int]int
+
+func (m slotMap) ShardForSlot(slot int) int {
+	return m[slot]
+}
+
+func TestModuloStrategy(t *testing.T) {
+	m := NewModuloStrategy(3)
+	tests := []struct {
+		slot, shard int
+	}{
+		{0, 0}, {1, 1}, {2, 2}, {3, 0}, {idgen.SlotCount - 1, (idgen.SlotCount - 1) % 3},
+	}
+	for _, tt := range tests {
+		if got := m.ShardForSlot(tt.slot); got != tt.shard {
+			t.Errorf("ShardForSlot(%d) = %d, want %d", tt.slot, got, tt.shard)
+		}
+	}
+}
+
+func TestNewConsistentHashStrategyRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		vnodes  int
+	}{
+		{"no shards", nil, 160},
+		{"no vnodes", []int{1, 1}, 0},
+		{"negative vnodes", []int{1, 1}, -1},
+		{"negative weight", []int{1, -1}, 160},
+		{"all weights zero", []int{0, 0}, 160},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewConsistentHashStrategy(tt.weights, tt.vnodes); err == nil {
+				t.Fatal("NewConsistentHashStrategy succeeded")
+			}
+		})
+	}
+}
+
+func slotsPerShard(t *testing.T, s Strategy) []int {
+	t.Helper()
+	counts := make([]int, s.ShardCount())
+	for slot := 0; slot < idgen.SlotCount; slot++ {
+		shard := s.ShardForSlot(slot)
+		if shard < 0 || shard >= s.ShardCount() {
+			t.Fatalf("slot %d maps to shard %d of %d", slot, shard, s.ShardCount())
+		}
+		counts[shard]++
+	}
+	return counts
+}
+
+func TestConsistentHashStrategySpreadsByWeight(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		// share is the fraction of slots each shard should own, within
+		// tolerance
+		share     []float64
+		tolerance float64
+	}{
+		{"equal", []int{1, 1, 1}, []float64{1. / 3, 1. / 3, 1. / 3}, 0.08},
+		{"double", []int{1, 1, 2}, []float64{0.25, 0.25, 0.5}, 0.08},
+		{"weight zero owns nothing", []int{1, 0, 1}, []float64{0.5, 0, 0.5}, 0.08},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewConsistentHashStrategy(tt.weights, 160)
+			if err != nil {
+				t.Fatalf("NewConsistentHashStrategy: %v", err)
+			}
+			for shard, n := range slotsPerShard(t, s) {
+				got := float64(n) / idgen.SlotCount
+				if got < tt.share[shard]-tt.tolerance || got > tt.share[shard]+tt.tolerance {
+					t.Errorf("shard %d owns %.3f of the slots, want %.3f", shard, got, tt.share[shard])
+				}
+			}
+		})
+	}
+}
+
+func TestConsistentHashStrategyIsStable(t *testing.T) {
+	a, err := NewConsistentHashStrategy([]int{1, 2, 1}, 160)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewConsistentHashStrategy([]int{1, 2, 1}, 160)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moves := Moves(a, b); len(moves) != 0 {
+		t.Fatalf("the same ring moves %d slot ranges", len(moves))
+	}
+}
+
+func TestConsistentHashStrategyAddingAShardOnlyMovesToIt(t *testing.T) {
+	before, err := NewConsistentHashStrategy([]int{1, 1, 1}, 160)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := NewConsistentHashStrategy([]int{1, 1, 1, 1}, 160)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := 0
+	for _, move := range Moves(before, after) {
+		if move.To != 3 {
+			t.Fatalf("slots %d-%d move from shard %d to %d, not to the new shard", move.Start, move.End-1, move.From, move.To)
+		}
+		moved += move.End - move.Start
+	}
+	// a quarter of the slots, give or take
+	if moved < idgen.SlotCount/8 || moved > idgen.SlotCount*3/8 {
+		t.Fatalf("%d of %d slots moved", moved, idgen.SlotCount)
+	}
+}
+
+func TestMoves(t *testing.T) {
+	last := idgen.SlotCount - 1
+	tests := []struct {
+		name     string
+		from, to SlotMapper
+		want     []SlotRange
+	}{
+		{"nothing changes", slotMap{}, slotMap{}, nil},
+		{"single slot", slotMap{}, slotMap{5: 1}, []SlotRange{{Start: 5, End: 6, From: 0, To: 1}}},
+		{
+			"consecutive slots merge",
+			slotMap{}, slotMap{5: 1, 6: 1, 7: 1},
+			[]SlotRange{{Start: 5, End: 8, From: 0, To: 1}},
+		},
+		{
+			"different target splits",
+			slotMap{}, slotMap{5: 1, 6: 2},
+			[]SlotRange{{Start: 5, End: 6, From: 0, To: 1}, {Start: 6, End: 7, From: 0, To: 2}},
+		},
+		{
+			"different source splits",
+			slotMap{6: 2}, slotMap{5: 1, 6: 1},
+			[]SlotRange{{Start: 5, End: 6, From: 0, To: 1}, {Start: 6, End: 7, From: 2, To: 1}},
+		},
+		{
+			"gap splits",
+			slotMap{}, slotMap{5: 1, 7: 1},
+			[]SlotRange{{Start: 5, End: 6, From: 0, To: 1}, {Start: 7, End: 8, From: 0, To: 1}},
+		},
+		{"last slot", slotMap{}, slotMap{last: 1}, []SlotRange{{Start: last, End: last + 1, From: 0, To: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Moves(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Moves = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMovesFollowsTopologyOverrides(t *testing.T) {
+	router := NewShardRouter(NewModuloStrategy(2))
+	router.SetTopology(&Topology{Overrides: map[int]int{0: 1}})
+	want := []SlotRange{{Start: 0, End: 1, From: 1, To: 0}}
+	if got := Moves(router, NewModuloStrategy(2)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Moves = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,173 @@
+package sharding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"order-service/internal/idgen"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog"
+)
+
+var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+const (
+	topologyKey = "sharding:topology"
+	// ackKeyPrefix is followed by an instance ID; the value is the topology
+	// version the instance routes with.
+	ackKeyPrefix = "sharding:topology:ack:"
+)
+
+var ErrTopologyChanged = errors.New("sharding: topology changed concurrently")
+
+// Topology is the routing state shared by every instance through Redis
+// while slots are being moved between shards. Overrides route a slot to a
+// shard other than the one the strategy picks; DualWrite names a second
+// shard that receives a copy of every write to the slot. Writes to Fenced
+// slots are refused while their routing is flipped.
+type Topology struct {
+	Version   int64        `json:"version"`
+	Overrides map[int]int  `json:"overrides,omitempty"`
+	DualWrite map[int]int  `json:"dual_write,omitempty"`
+	Fenced    map[int]bool `json:"fenced,omitempty"`
+}
+
+// saveTopologyScript stores the topology only if the stored version is the
+// one it was derived from, so concurrent writers cannot lose updates.
+var saveTopologyScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+local version = 0
+if current then
+	version = cjson.decode(current)["version"]
+end
+if tonumber(version) ~= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2])
+return 1
+`)
+
+// LoadTopology returns the stored topology, or an empty one when none has
+// been saved yet.
+func LoadTopology(ctx context.Context, rdb *redis.Client) (*Topology, error) {
+	raw, err := rdb.Get(ctx, topologyKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return &Topology{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := &Topology{}
+	if err := json.Unmarshal(raw, t); err != nil {
+		return nil, fmt.Errorf("decode topology: %w", err)
+	}
+	return t, nil
+}
+
+// SaveTopology replaces the stored topology in a single write and bumps its
+// version. t.Version must be the version it was loaded with.
+func SaveTopology(ctx context.Context, rdb *redis.Client, t *Topology) error {
+	next := *t
+	next.Version = t.Version + 1
+	raw, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	saved, err := saveTopologyScript.Run(ctx, rdb, []string{topologyKey}, t.Version, raw).Int()
+	if err != nil {
+		return err
+	}
+	if saved == 0 {
+		return ErrTopologyChanged
+	}
+	t.Version = next.Version
+	return nil
+}
+
+func (r *ShardRouter) SetTopology(t *Topology) {
+	r.topology.Store(t)
+}
+
+// Fenced reports whether writes to the order are refused because its slot
+// is being flipped to another shard.
+func (r *ShardRouter) Fenced(orderID int64) bool {
+	t := r.topology.Load()
+	return t != nil && t.Fenced[idgen.Slot(orderID)]
+}
+
+// WatchTopology polls Redis for topology changes until ctx is done. Every
+// poll acknowledges the version the instance routes with, so a topology
+// change can wait for all instances to apply it.
+func (r *ShardRouter) WatchTopology(ctx context.Context, rdb *redis.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	host, _ := os.Hostname()
+	ackKey := fmt.Sprintf("%s%s-%d", ackKeyPrefix, host, os.Getpid())
+	for {
+		t, err := LoadTopology(ctx, rdb)
+		if err != nil {
+			logger.Error().Err(err).Msg("error loading shard topology")
+		} else {
+			if current := r.topology.Load(); current == nil || current.Version != t.Version {
+				logger.Info().Msgf("applying shard topology version %d", t.Version)
+				r.SetTopology(t)
+			}
+			if err := rdb.Set(ctx, ackKey, t.Version, 3*interval).Err(); err != nil {
+				logger.Error().Err(err).Msg("error acknowledging shard topology")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitForTopology blocks until every running instance acknowledged routing
+// with at least the given topology version, or timeout passes.
+func WaitForTopology(ctx context.Context, rdb *redis.Client, version int64, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		behind, err := instancesBehind(ctx, rdb, version)
+		if err != nil {
+			return err
+		}
+		if behind == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d instances have not applied shard topology version %d", behind, version)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func instancesBehind(ctx context.Context, rdb *redis.Client, version int64) (int, error) {
+	behind := 0
+	iter := rdb.Scan(ctx, 0, ackKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		raw, err := rdb.Get(ctx, iter.Val()).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		acked, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || acked < version {
+			behind++
+		}
+	}
+	return behind, iter.Err()
+}
@@ -0,0 +1,123 @@
+// Package tax works out the tax of orders from their shipping region and
+// the tax category of each product.
+package tax
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"order-service/internal/entity"
+	"os"
+)
+
+const (
+	// DefaultCategory is used for products pricing gives no category.
+	DefaultCategory = "standard"
+	// Any matches every region or category in a rule.
+	Any = "*"
+)
+
+// Calculator sets the tax of every line of an order and the order's
+// TotalTax. It does not change FinalPrice or Total.
+type Calculator interface {
+	Calculate(ctx context.Context, order *entity.OrderEntity) error
+}
+
+// Rule taxes the products of Category shipped to Region at Rate, a decimal
+// fraction such as "0.11". Inclusive rules treat prices as already holding
+// the tax.
+type Rule struct {
+	Region    string `json:"region"`
+	Category  string `json:"category"`
+	Rate      string `json:"rate"`
+	Inclusive bool   `json:"inclusive"`
+}
+
+type ruleKey struct {
+	region   string
+	category string
+}
+
+// RulesCalculator looks rules up in a table. The most specific rule wins:
+// region and category, then region with any category, then any region with
+// the category, then the catch-all rule.
+type RulesCalculator struct {
+	rules map[ruleKey]Rule
+	rates map[ruleKey]*big.Rat
+}
+
+func NewRulesCalculator(rules []Rule) (*RulesCalculator, error) {
+	c := &RulesCalculator{
+		rules: make(map[ruleKey]Rule, len(rules)),
+		rates: make(map[ruleKey]*big.Rat, len(rules)),
+	}
+	for _, rule := range rules {
+		rate, ok := new(big.Rat).SetString(rule.Rate)
+		if !ok || rate.Sign() < 0 {
+			return nil, fmt.Errorf("invalid tax rate %q for %s/%s", rule.Rate, rule.Region, rule.Category)
+		}
+		key := ruleKey{region: rule.Region, category: rule.Category}
+		if _, exists := c.rules[key]; exists {
+			return nil, fmt.Errorf("duplicate tax rule for %s/%s", rule.Region, rule.Category)
+		}
+		c.rules[key] = rule
+		c.rates[key] = rate
+	}
+	return c, nil
+}
+
+// LoadRulesCalculator reads a JSON array of rules from a file.
+func LoadRulesCalculator(path string) (*RulesCalculator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return NewRulesCalculator(rules)
+}
+
+func (c *RulesCalculator) lookup(region, category string) (Rule, *big.Rat, bool) {
+	for _, key := range []ruleKey{{region, category}, {region, Any}, {Any, category}, {Any, Any}} {
+		if rule, ok := c.rules[key]; ok {
+			return rule, c.rates[key], true
+		}
+	}
+	return Rule{}, nil, false
+}
+
+// Calculate rounds the tax of every line half-even; the order's tax is the
+// sum of its lines.
+func (c *RulesCalculator) Calculate(ctx context.Context, order *entity.OrderEntity) error {
+	order.TotalTax = entity.NewMoney(0, order.Currency)
+	for i := range order.ProductRequests {
+		line := &order.ProductRequests[i]
+		if line.TaxCategory == "" {
+			line.TaxCategory = DefaultCategory
+		}
+		rule, rate, ok := c.lookup(order.ShippingRegion, line.TaxCategory)
+		if !ok {
+			return fmt.Errorf("%w for category %s in region %q", entity.ErrNoTaxRule, line.TaxCategory, order.ShippingRegion)
+		}
+
+		// exclusive: price * rate; inclusive: price * rate / (1 + rate)
+		factor := new(big.Rat).Set(rate)
+		if rule.Inclusive {
+			factor.Quo(rate, new(big.Rat).Add(big.NewRat(1, 1), rate))
+		}
+		tax, err := line.FinalPrice.MulBigRat(factor, entity.RoundHalfEven)
+		if err != nil {
+			return err
+		}
+		line.Tax = tax
+		line.TaxRate = rule.Rate
+		line.TaxInclusive = rule.Inclusive
+		if order.TotalTax, err = order.TotalTax.Add(line.Tax); err != nil {
+			return err
+		}
+	}
+	return nil
+}
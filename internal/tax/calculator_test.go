@@ -0,0 +1,191 @@
+package tax
+
+import (
+	"context"
+	"errors"
+	"order-service/internal/entity"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newCalculator(t *testing.T, rules []Rule) *RulesCalculator {
+	t.Helper()
+	c, err := NewRulesCalculator(rules)
+	if err != nil {
+		t.Fatalf("NewRulesCalculator: %v", err)
+	}
+	return c
+}
+
+func idr(amount int64) entity.Money {
+	return entity.NewMoney(amount, "IDR")
+}
+
+func TestRulesCalculatorPrecedence(t *testing.T) {
+	c := newCalculator(t, []Rule{
+		{Region: Any, Category: Any, Rate: "0.10"},
+		{Region: Any, Category: "food", Rate: "0.05"},
+		{Region: "ID-JK", Category: Any, Rate: "0.11"},
+		{Region: "ID-JK", Category: "food", Rate: "0"},
+	})
+	tests := []struct {
+		region, category string
+		rate             string
+	}{
+		{"ID-JK", "food", "0"},
+		{"ID-JK", "books", "0.11"},
+		{"ID-JK", "", "0.11"},
+		{"ID-BA", "food", "0.05"},
+		{"ID-BA", "books", "0.10"},
+		{"", "", "0.10"},
+	}
+	for _, tt := range tests {
+		order := &entity.OrderEntity{
+			Currency:        "IDR",
+			ShippingRegion:  tt.region,
+			ProductRequests: []entity.ProductRequest{{TaxCategory: tt.category, FinalPrice: idr(100000)}},
+		}
+		if err := c.Calculate(context.Background(), order); err != nil {
+			t.Errorf("%s/%s: %v", tt.region, tt.category, err)
+			continue
+		}
+		if got := order.ProductRequests[0].TaxRate; got != tt.rate {
+			t.Errorf("%s/%s taxed at %s, want %s", tt.region, tt.category, got, tt.rate)
+		}
+	}
+}
+
+func TestRulesCalculatorCalculate(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      Rule
+		price     int64
+		tax       int64
+		inclusive bool
+	}{
+		{"exclusive", Rule{Region: Any, Category: Any, Rate: "0.11"}, 100000, 11000, false},
+		{"inclusive", Rule{Region: Any, Category: Any, Rate: "0.11", Inclusive: true}, 111000, 11000, true},
+		{"exclusive half to even down", Rule{Region: Any, Category: Any, Rate: "0.1"}, 125, 12, false},
+		{"exclusive half to even up", Rule{Region: Any, Category: Any, Rate: "0.1"}, 135, 14, false},
+		// a 100% inclusive rate is half the price
+		{"inclusive half to even down", Rule{Region: Any, Category: Any, Rate: "1", Inclusive: true}, 5, 2, true},
+		{"inclusive half to even up", Rule{Region: Any, Category: Any, Rate: "1", Inclusive: true}, 7, 4, true},
+		{"inclusive rounds", Rule{Region: Any, Category: Any, Rate: "0.11", Inclusive: true}, 100000, 9910, true},
+		{"zero rate", Rule{Region: Any, Category: Any, Rate: "0"}, 100000, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCalculator(t, []Rule{tt.rule})
+			order := &entity.OrderEntity{
+				Currency:        "IDR",
+				ProductRequests: []entity.ProductRequest{{FinalPrice: idr(tt.price)}},
+			}
+			if err := c.Calculate(context.Background(), order); err != nil {
+				t.Fatalf("Calculate: %v", err)
+			}
+			line := order.ProductRequests[0]
+			if line.Tax != idr(tt.tax) || line.TaxInclusive != tt.inclusive || line.TaxRate != tt.rule.Rate {
+				t.Fatalf("tax = %d at %s inclusive %v, want %d at %s inclusive %v",
+					line.Tax.Amount, line.TaxRate, line.TaxInclusive, tt.tax, tt.rule.Rate, tt.inclusive)
+			}
+			if line.FinalPrice != idr(tt.price) {
+				t.Fatalf("final price changed to %d", line.FinalPrice.Amount)
+			}
+		})
+	}
+}
+
+func TestRulesCalculatorSumsLines(t *testing.T) {
+	c := newCalculator(t, []Rule{
+		{Region: "ID-JK", Category: DefaultCategory, Rate: "0.11"},
+		{Region: "ID-JK", Category: "food", Rate: "0.05", Inclusive: true},
+	})
+	order := &entity.OrderEntity{
+		Currency:       "IDR",
+		ShippingRegion: "ID-JK",
+		TotalTax:       idr(99),
+		ProductRequests: []entity.ProductRequest{
+			{FinalPrice: idr(100000)},
+			{TaxCategory: "food", FinalPrice: idr(105000)},
+		},
+	}
+	if err := c.Calculate(context.Background(), order); err != nil {
+		t.Fatalf("Calculate: %v", err)
+	}
+	if got := order.ProductRequests[0].TaxCategory; got != DefaultCategory {
+		t.Errorf("line without a category got %q, want %q", got, DefaultCategory)
+	}
+	if order.TotalTax != idr(16000) {
+		t.Errorf("total tax = %d, want 16000", order.TotalTax.Amount)
+	}
+}
+
+func TestRulesCalculatorNoRule(t *testing.T) {
+	c := newCalculator(t, []Rule{{Region: "ID-JK", Category: "food", Rate: "0.05"}})
+	tests := []struct {
+		region, category string
+	}{
+		{"ID-JK", "books"},
+		{"ID-JK", ""},
+		{"ID-BA", "food"},
+	}
+	for _, tt := range tests {
+		order := &entity.OrderEntity{
+			Currency:        "IDR",
+			ShippingRegion:  tt.region,
+			ProductRequests: []entity.ProductRequest{{TaxCategory: tt.category, FinalPrice: idr(100000)}},
+		}
+		if err := c.Calculate(context.Background(), order); !errors.Is(err, entity.ErrNoTaxRule) {
+			t.Errorf("%s/%s: Calculate = %v, want %v", tt.region, tt.category, err, entity.ErrNoTaxRule)
+		}
+	}
+}
+
+func TestNewRulesCalculatorRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+	}{
+		{"not a number", []Rule{{Region: Any, Category: Any, Rate: "eleven"}}},
+		{"empty rate", []Rule{{Region: Any, Category: Any}}},
+		{"negative rate", []Rule{{Region: Any, Category: Any, Rate: "-0.1"}}},
+		{"duplicate", []Rule{
+			{Region: "ID-JK", Category: "food", Rate: "0.05"},
+			{Region: "ID-JK", Category: "food", Rate: "0.11", Inclusive: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRulesCalculator(tt.rules); err == nil {
+				t.Fatal("NewRulesCalculator succeeded")
+			}
+		})
+	}
+}
+
+func TestLoadRulesCalculator(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(valid, []byte(`[{"region":"*","category":"*","rate":"0.11","inclusive":true}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadRulesCalculator(valid)
+	if err != nil {
+		t.Fatalf("LoadRulesCalculator: %v", err)
+	}
+	if rule, _, ok := c.lookup("ID-JK", DefaultCategory); !ok || rule.Rate != "0.11" || !rule.Inclusive {
+		t.Fatalf("lookup = %+v, %v", rule, ok)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"region":"*"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRulesCalculator(invalid); err == nil {
+		t.Fatal("LoadRulesCalculator accepted an object")
+	}
+	if _, err := LoadRulesCalculator(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatal("LoadRulesCalculator accepted a missing file")
+	}
+}
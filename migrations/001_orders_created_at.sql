@@ -0,0 +1,5 @@
+-- Apply on every order shard.
+ALTER TABLE orders
+    ADD COLUMN created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6);
+
+CREATE INDEX idx_orders_user_created ON orders (user_id, created_at, id);
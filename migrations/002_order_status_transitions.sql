@@ -0,0 +1,11 @@
+-- Apply on every order shard.
+CREATE TABLE order_status_transitions (
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    order_id    BIGINT       NOT NULL,
+    from_status VARCHAR(32)  NOT NULL,
+    to_status   VARCHAR(32)  NOT NULL,
+    actor       VARCHAR(128) NOT NULL,
+    reason      VARCHAR(255) NOT NULL DEFAULT '',
+    created_at  DATETIME(6)  NOT NULL,
+    INDEX idx_order_status_transitions_order (order_id, id)
+);
@@ -0,0 +1,31 @@
+-- Apply on every order shard, setting @shard_slot to a slot the configured
+-- SHARD_STRATEGY routes to that shard, as printed by
+-- `go run ./cmd/reshard -legacy-slots` with the service's SHARD_*
+-- environment. Under the modulo strategy that is the index of the shard
+-- (0 for DB1, 1 for DB2, ...); under the consistent strategy it is not, and
+-- using the index would route legacy orders to the wrong shard. Switching
+-- strategies later moves these orders with their slot, through reshard.
+--
+-- Order IDs are now generated by internal/idgen and encode their shard slot.
+-- Legacy rows get an ID built from their auto-increment id and the shard
+-- slot, which keeps them unique across shards and routable, and sorts them
+-- before every generated ID. product_requests and order_status_transitions
+-- now reference orders.order_id instead of orders.id.
+SET @shard_slot = 0;
+
+ALTER TABLE orders MODIFY order_id BIGINT NOT NULL;
+ALTER TABLE product_requests MODIFY order_id BIGINT NOT NULL;
+
+UPDATE product_requests pr
+    JOIN orders o ON pr.order_id = o.id
+    SET pr.order_id = (o.id << 22) | (@shard_slot << 12);
+
+UPDATE order_status_transitions t
+    JOIN orders o ON t.order_id = o.id
+    SET t.order_id = (o.id << 22) | (@shard_slot << 12);
+
+UPDATE orders SET order_id = (id << 22) | (@shard_slot << 12);
+
+ALTER TABLE orders ADD UNIQUE INDEX uq_orders_order_id (order_id);
+CREATE INDEX idx_orders_user_order ON orders (user_id, order_id);
+CREATE INDEX idx_product_requests_order ON product_requests (order_id);
@@ -0,0 +1,13 @@
+-- Apply on every order shard.
+CREATE TABLE order_outbox (
+    id              BIGINT AUTO_INCREMENT PRIMARY KEY,
+    order_id        BIGINT       NOT NULL,
+    event_type      VARCHAR(64)  NOT NULL,
+    payload         JSON         NOT NULL,
+    attempts        INT          NOT NULL DEFAULT 0,
+    last_error      VARCHAR(512) NOT NULL DEFAULT '',
+    next_attempt_at DATETIME(6)  NOT NULL,
+    created_at      DATETIME(6)  NOT NULL,
+    sent_at         DATETIME(6)  NULL,
+    INDEX idx_order_outbox_pending (sent_at, id)
+);
@@ -0,0 +1,2 @@
+-- Apply on every order shard. Supports the unpaid order expiry scan.
+CREATE INDEX idx_orders_status_created ON orders (status, created_at);
@@ -0,0 +1,2 @@
+-- Apply on every order shard. Marks orders priced with a last known price.
+ALTER TABLE orders ADD COLUMN price_fallback BOOLEAN NOT NULL DEFAULT FALSE;
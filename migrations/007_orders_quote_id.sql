@@ -0,0 +1,2 @@
+-- Apply on every order shard. Records the price quote an order was created with.
+ALTER TABLE orders ADD COLUMN quote_id VARCHAR(32) NOT NULL DEFAULT '';
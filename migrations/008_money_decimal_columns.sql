@@ -0,0 +1,11 @@
+-- Apply on every order shard. Stores amounts as exact decimals; existing
+-- values are rounded to 4 places by MySQL and to minor units when read.
+ALTER TABLE orders
+    MODIFY COLUMN total          DECIMAL(20, 4) NOT NULL DEFAULT 0,
+    MODIFY COLUMN total_mark_up  DECIMAL(20, 4) NOT NULL DEFAULT 0,
+    MODIFY COLUMN total_discount DECIMAL(20, 4) NOT NULL DEFAULT 0;
+
+ALTER TABLE product_requests
+    MODIFY COLUMN mark_up     DECIMAL(20, 4) NOT NULL DEFAULT 0,
+    MODIFY COLUMN discount    DECIMAL(20, 4) NOT NULL DEFAULT 0,
+    MODIFY COLUMN final_price DECIMAL(20, 4) NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+-- Apply on every order shard. Existing orders were all placed in IDR.
+ALTER TABLE orders
+    ADD COLUMN currency      CHAR(3)        NOT NULL DEFAULT 'IDR',
+    ADD COLUMN base_currency CHAR(3)        NOT NULL DEFAULT 'IDR',
+    ADD COLUMN fx_rate       DECIMAL(24, 12) NOT NULL DEFAULT 1,
+    ADD COLUMN fx_rate_at    DATETIME(6)    NULL,
+    ADD COLUMN base_total    DECIMAL(20, 4) NOT NULL DEFAULT 0;
+
+UPDATE orders SET base_total = total;
+
+CREATE INDEX idx_orders_created ON orders (created_at);
@@ -0,0 +1,7 @@
+-- Apply on every order shard. Keeps the coupons of an order and the
+-- promotion discount of each line, broken down per coupon.
+ALTER TABLE orders ADD COLUMN coupon_codes VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE product_requests
+    ADD COLUMN promo_discount DECIMAL(20, 4) NOT NULL DEFAULT 0,
+    ADD COLUMN promotions     JSON           NULL;
@@ -0,0 +1,10 @@
+-- Apply on every order shard. Stores the tax of orders and their lines.
+ALTER TABLE orders
+    ADD COLUMN shipping_region VARCHAR(16)    NOT NULL DEFAULT '',
+    ADD COLUMN total_tax       DECIMAL(20, 4) NOT NULL DEFAULT 0;
+
+ALTER TABLE product_requests
+    ADD COLUMN tax_category  VARCHAR(32)    NOT NULL DEFAULT '',
+    ADD COLUMN tax           DECIMAL(20, 4) NOT NULL DEFAULT 0,
+    ADD COLUMN tax_rate      VARCHAR(16)    NOT NULL DEFAULT '',
+    ADD COLUMN tax_inclusive BOOLEAN        NOT NULL DEFAULT FALSE;
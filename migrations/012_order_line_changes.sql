@@ -0,0 +1,14 @@
+-- Apply on every order shard. History of lines cancelled or reduced after
+-- the order was placed.
+CREATE TABLE order_line_changes (
+    id            BIGINT AUTO_INCREMENT PRIMARY KEY,
+    order_id      BIGINT       NOT NULL,
+    line_index    INT          NOT NULL,
+    product_id    INT          NOT NULL,
+    from_quantity INT          NOT NULL,
+    to_quantity   INT          NOT NULL,
+    actor         VARCHAR(128) NOT NULL,
+    reason        VARCHAR(255) NOT NULL DEFAULT '',
+    created_at    DATETIME(6)  NOT NULL,
+    INDEX idx_order_line_changes_order (order_id, id)
+);
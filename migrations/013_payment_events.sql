@@ -0,0 +1,10 @@
+-- Apply on every order shard. Payment events already applied to the
+-- orders of the shard, so redelivered events are skipped.
+CREATE TABLE payment_events (
+    event_id     VARCHAR(128) NOT NULL PRIMARY KEY,
+    order_id     BIGINT       NOT NULL,
+    type         VARCHAR(32)  NOT NULL,
+    outcome      VARCHAR(16)  NOT NULL,
+    processed_at DATETIME(6)  NOT NULL,
+    INDEX idx_payment_events_order (order_id)
+);
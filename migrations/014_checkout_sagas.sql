@@ -0,0 +1,12 @@
+-- Apply on every order shard. State of every checkout, so sagas left
+-- behind by a stopped instance are resumed or compensated.
+CREATE TABLE checkout_sagas (
+    order_id   BIGINT       NOT NULL PRIMARY KEY,
+    step       INT          NOT NULL,
+    status     VARCHAR(16)  NOT NULL,
+    state      JSON         NOT NULL,
+    error      VARCHAR(512) NOT NULL DEFAULT '',
+    created_at DATETIME(6)  NOT NULL,
+    updated_at DATETIME(6)  NOT NULL,
+    INDEX idx_checkout_sagas_status (status, updated_at)
+);
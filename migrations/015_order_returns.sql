@@ -0,0 +1,22 @@
+-- Apply on every order shard. Return requests per order line and their
+-- refunds. return_id comes from the order ID generator, so rows keep their
+-- ID when resharding copies them.
+CREATE TABLE order_returns (
+    return_id       BIGINT         NOT NULL PRIMARY KEY,
+    order_id        BIGINT         NOT NULL,
+    line_index      INT            NOT NULL,
+    product_id      INT            NOT NULL,
+    quantity        INT            NOT NULL,
+    reason          VARCHAR(255)   NOT NULL DEFAULT '',
+    status          VARCHAR(16)    NOT NULL,
+    refund_amount   DECIMAL(20, 4) NOT NULL DEFAULT 0,
+    refund_mark_up  DECIMAL(20, 4) NOT NULL DEFAULT 0,
+    refund_discount DECIMAL(20, 4) NOT NULL DEFAULT 0,
+    refund_tax      DECIMAL(20, 4) NOT NULL DEFAULT 0,
+    actor           VARCHAR(128)   NOT NULL,
+    reviewer        VARCHAR(128)   NOT NULL DEFAULT '',
+    note            VARCHAR(255)   NOT NULL DEFAULT '',
+    created_at      DATETIME(6)    NOT NULL,
+    updated_at      DATETIME(6)    NOT NULL,
+    INDEX idx_order_returns_order (order_id)
+);
@@ -0,0 +1,15 @@
+-- Apply on every order shard. Append-only audit log of every change to an
+-- order, written in the transaction of the change. Checkout sagas keep the
+-- actor that started them, who is recorded as the creator of the order.
+CREATE TABLE order_events (
+    id           BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    order_id     BIGINT       NOT NULL,
+    actor        VARCHAR(128) NOT NULL,
+    action       VARCHAR(32)  NOT NULL,
+    before_state JSON         NULL,
+    after_state  JSON         NULL,
+    created_at   DATETIME(6)  NOT NULL,
+    INDEX idx_order_events_order (order_id, id)
+);
+
+ALTER TABLE checkout_sagas ADD COLUMN actor VARCHAR(128) NOT NULL DEFAULT '' AFTER status;
@@ -0,0 +1,4 @@
+-- Apply on every order shard. Version of the order row, raised by every
+-- change to it, for optimistic concurrency control: clients send the
+-- version they read back as If-Match.
+ALTER TABLE orders ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
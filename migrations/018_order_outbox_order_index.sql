@@ -0,0 +1,3 @@
+-- Apply on every order shard. Lets the relay find the oldest unsent
+-- message of each order.
+CREATE INDEX idx_order_outbox_order ON order_outbox (order_id, sent_at, id);
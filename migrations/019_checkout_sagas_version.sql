@@ -0,0 +1,4 @@
+-- Apply on every order shard. Version of the saga row, raised by every
+-- save, so two instances running the same saga cannot overwrite each
+-- other's progress.
+ALTER TABLE checkout_sagas ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,6 @@
+-- Apply on every order shard. Identity of an audit log entry that survives
+-- copying it to another shard, so copies are appended once and never
+-- replace the log.
+ALTER TABLE order_events ADD COLUMN event_id CHAR(32) NULL AFTER id;
+UPDATE order_events SET event_id = REPLACE(UUID(), '-', '') WHERE event_id IS NULL;
+ALTER TABLE order_events MODIFY event_id CHAR(32) NOT NULL, ADD UNIQUE INDEX idx_order_events_event_id (event_id);